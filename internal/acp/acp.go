@@ -0,0 +1,465 @@
+// Package acp runs Otter as an Agent Client Protocol agent, so editors such
+// as Zed can drive it over stdio JSON-RPC
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/abcdlsj/otter/internal/agent"
+	"github.com/abcdlsj/otter/internal/attach"
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/diff"
+	"github.com/abcdlsj/otter/internal/event"
+	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/msg"
+	"github.com/abcdlsj/otter/internal/tool"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const protocolVersion = 1
+
+type Server struct {
+	llm   *llm.LLM
+	tools *tool.Set
+	bus   *msg.Bus
+	conn  *conn
+
+	mu       sync.Mutex
+	fs       fsCapability
+	sessions map[string]*session
+}
+
+// fsCapability is what the client offered to do with files
+type fsCapability struct {
+	ReadTextFile  bool `json:"readTextFile"`
+	WriteTextFile bool `json:"writeTextFile"`
+}
+
+type session struct {
+	id      string
+	cancel  context.CancelFunc // set while a prompt runs
+	allowed map[string]bool    // tools the user allowed for the rest of the session
+}
+
+func New(l *llm.LLM, tools *tool.Set, bus *msg.Bus) *Server {
+	return &Server{
+		llm:      l,
+		tools:    tools,
+		bus:      bus,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Serve speaks ACP on r and w until r ends
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w, s.handle)
+	return s.conn.serve(ctx)
+}
+
+func (s *Server) handle(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		return s.initialize(params)
+	case "authenticate":
+		return struct{}{}, nil
+	case "session/new":
+		return s.newSession(params)
+	case "session/prompt":
+		return s.prompt(ctx, params)
+	case "session/cancel":
+		return nil, s.cancel(params)
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+func decode(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, error) {
+	var req struct {
+		ClientCapabilities struct {
+			FS fsCapability `json:"fs"`
+		} `json:"clientCapabilities"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.fs = req.ClientCapabilities.FS
+	s.mu.Unlock()
+
+	return map[string]any{
+		"protocolVersion": protocolVersion,
+		"agentCapabilities": map[string]any{
+			"loadSession": false,
+			"promptCapabilities": map[string]any{
+				"image":           false,
+				"audio":           false,
+				"embeddedContext": true,
+			},
+		},
+		"authMethods": []any{},
+	}, nil
+}
+
+func (s *Server) newSession(params json.RawMessage) (any, error) {
+	var req struct {
+		Cwd string `json:"cwd"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Tools resolve paths against the process's directory, so the first
+	// session sets it and later ones must share it
+	if req.Cwd != "" {
+		if wd, _ := os.Getwd(); filepath.Clean(wd) != filepath.Clean(req.Cwd) {
+			if len(s.sessions) > 0 {
+				return nil, fmt.Errorf("this agent works in %s; start another one for %s", wd, req.Cwd)
+			}
+			if err := os.Chdir(req.Cwd); err != nil {
+				return nil, fmt.Errorf("cannot use %s as the working directory: %w", req.Cwd, err)
+			}
+		}
+	}
+
+	id := msg.NewSessionID()
+	s.bus.GetOrCreateSession(id)
+	s.sessions[id] = &session{id: id, allowed: make(map[string]bool)}
+	return map[string]any{"sessionId": id}, nil
+}
+
+func (s *Server) session(id string) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "unknown session: " + id}
+	}
+	return sess, nil
+}
+
+func (s *Server) cancel(params json.RawMessage) error {
+	var req struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := decode(params, &req); err != nil {
+		return err
+	}
+	sess, err := s.session(req.SessionID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess.cancel != nil {
+		sess.cancel()
+	}
+	return nil
+}
+
+// contentBlock is the part of an ACP content block Otter reads
+type contentBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	URI      string `json:"uri"` // resource_link
+	Resource struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"resource"`
+}
+
+// prompt runs one turn and answers with why it stopped
+func (s *Server) prompt(ctx context.Context, params json.RawMessage) (any, error) {
+	var req struct {
+		SessionID string         `json:"sessionId"`
+		Prompt    []contentBlock `json:"prompt"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	sess, err := s.session(req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	text, atts := s.promptContent(ctx, req.Prompt)
+	if strings.TrimSpace(text) == "" && len(atts) == 0 {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "empty prompt"}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	if sess.cancel != nil {
+		s.mu.Unlock()
+		return nil, errors.New("a prompt is already running in this session")
+	}
+	sess.cancel = cancel
+	fs := s.fs
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		sess.cancel = nil
+		s.mu.Unlock()
+	}()
+
+	history := msg.ToLLM(s.bus.GetOrCreateSession(sess.id).Messages)
+	user := msg.User(sess.id, text)
+	user.Attachments = atts
+	s.bus.Pub(user)
+
+	ctx = tool.WithFS(ctx, &clientFS{conn: s.conn, session: sess.id, cap: fs})
+	ctx = tool.WithApproval(ctx, s.approve(sess))
+	lg := logger.NewFileLogger(logger.SessionLogDir(config.SessionsDir(), sess.id))
+	ag := agent.New(s.llm, s.tools)
+
+	stop := "cancelled"
+	var runErr error
+	for ev := range s.bus.HandleEvents(sess.id, ag.Run(ctx, lg, history, attach.Content(text, atts), nil, agent.Options{})) {
+		switch ev.Type {
+		case event.Done:
+			stop = "end_turn"
+		case event.Paused:
+			stop = "max_turn_requests"
+		case event.Error:
+			if data, ok := ev.Data.(event.ErrorData); ok && ctx.Err() == nil {
+				runErr = errors.New(data.Message)
+			}
+		}
+		s.update(sess.id, ev)
+	}
+	if runErr != nil {
+		return nil, runErr
+	}
+	return map[string]any{"stopReason": stop}, nil
+}
+
+// promptContent joins the prompt's text and turns the files it references
+// into attachments
+func (s *Server) promptContent(ctx context.Context, blocks []contentBlock) (string, []types.Attachment) {
+	var text []string
+	var atts []types.Attachment
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			text = append(text, b.Text)
+		case "resource":
+			path := uriPath(b.Resource.URI)
+			atts = append(atts, types.Attachment{Kind: "file", Ref: path, Path: path, Content: b.Resource.Text})
+		case "resource_link":
+			a, err := attach.Resolve(ctx, uriPath(b.URI))
+			if err != nil {
+				logger.Warn("acp: cannot attach resource", "uri", b.URI, "err", err)
+				continue
+			}
+			atts = append(atts, a)
+		}
+	}
+	return strings.Join(text, "\n"), atts
+}
+
+// uriPath returns the path of a file URI, relative to the working directory
+// when it's inside it
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, u.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return u.Path
+}
+
+// update sends an agent event to the client as a session/update
+func (s *Server) update(id string, ev event.Event) {
+	var u map[string]any
+	switch data := ev.Data.(type) {
+	case event.TextDeltaData:
+		u = map[string]any{
+			"sessionUpdate": "agent_message_chunk",
+			"content":       map[string]any{"type": "text", "text": data.Text},
+		}
+	case event.UserMessageData:
+		u = map[string]any{
+			"sessionUpdate": "user_message_chunk",
+			"content":       map[string]any{"type": "text", "text": data.Text},
+		}
+	case event.ToolStartData:
+		u = toolCall(data.ID, data.Name, data.Args)
+		u["sessionUpdate"] = "tool_call"
+		u["status"] = "in_progress"
+	case event.ToolEndData:
+		u = map[string]any{
+			"sessionUpdate": "tool_call_update",
+			"toolCallId":    data.ID,
+			"status":        "completed",
+			"content":       toolContent(data),
+		}
+		if data.Error != "" {
+			u["status"] = "failed"
+		}
+	default:
+		return
+	}
+	if err := s.conn.notify("session/update", map[string]any{"sessionId": id, "update": u}); err != nil {
+		logger.Warn("acp: session/update failed", "err", err)
+	}
+}
+
+// toolCall describes a call the way ACP clients show it
+func toolCall(id, name, args string) map[string]any {
+	var input map[string]any
+	json.Unmarshal([]byte(args), &input)
+	title := name
+	for _, key := range []string{"path", "cmd", "pattern", "url", "query", "description", "command"} {
+		if v, ok := input[key].(string); ok && v != "" {
+			title += ": " + types.TruncateRunes(strings.Join(strings.Fields(v), " "), 80)
+			break
+		}
+	}
+	call := map[string]any{
+		"toolCallId": id,
+		"title":      title,
+		"kind":       tool.Kind(name, json.RawMessage(args)),
+		"rawInput":   input,
+	}
+	if p, ok := input["path"].(string); ok && p != "" {
+		if abs, err := filepath.Abs(p); err == nil {
+			call["locations"] = []map[string]any{{"path": abs}}
+		}
+	}
+	return call
+}
+
+func toolContent(data event.ToolEndData) []map[string]any {
+	text := data.Result
+	if data.Error != "" {
+		text = data.Error
+	}
+	content := []map[string]any{{
+		"type":    "content",
+		"content": map[string]any{"type": "text", "text": text},
+	}}
+	for _, f := range data.Diffs {
+		path, _ := filepath.Abs(f.Path)
+		for _, h := range f.Hunks {
+			var before, after strings.Builder
+			for _, l := range h.Lines {
+				if l.Kind != diff.Insert {
+					before.WriteString(l.Text + "\n")
+				}
+				if l.Kind != diff.Delete {
+					after.WriteString(l.Text + "\n")
+				}
+			}
+			content = append(content, map[string]any{
+				"type":    "diff",
+				"path":    path,
+				"oldText": before.String(),
+				"newText": after.String(),
+			})
+		}
+	}
+	return content
+}
+
+// approve asks the client before edits and commands, remembering the tools
+// the user allows for the whole session
+func (s *Server) approve(sess *session) tool.Approve {
+	return func(ctx context.Context, tc types.ToolCall) error {
+		s.mu.Lock()
+		allowed := sess.allowed[tc.Name]
+		s.mu.Unlock()
+		if allowed {
+			return nil
+		}
+
+		call := toolCall(tc.ID, tc.Name, tc.Args)
+		call["status"] = "pending"
+		var resp struct {
+			Outcome struct {
+				Outcome  string `json:"outcome"`
+				OptionID string `json:"optionId"`
+			} `json:"outcome"`
+		}
+		err := s.conn.call(ctx, "session/request_permission", map[string]any{
+			"sessionId": sess.id,
+			"toolCall":  call,
+			"options": []map[string]any{
+				{"optionId": "allow", "name": "Allow", "kind": "allow_once"},
+				{"optionId": "allow_always", "name": "Always allow " + tc.Name, "kind": "allow_always"},
+				{"optionId": "reject", "name": "Reject", "kind": "reject_once"},
+			},
+		}, &resp)
+		if err != nil {
+			return fmt.Errorf("permission request failed: %w", err)
+		}
+		switch resp.Outcome.OptionID {
+		case "allow_always":
+			s.mu.Lock()
+			sess.allowed[tc.Name] = true
+			s.mu.Unlock()
+			return nil
+		case "allow":
+			if resp.Outcome.Outcome == "selected" {
+				return nil
+			}
+		}
+		return errors.New("the user rejected this call")
+	}
+}
+
+// clientFS reads and writes through the editor where it offered to, so the
+// agent sees unsaved buffers and the editor tracks its edits
+type clientFS struct {
+	conn    *conn
+	session string
+	cap     fsCapability
+}
+
+func (f *clientFS) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	if !f.cap.ReadTextFile {
+		return os.ReadFile(path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Content string `json:"content"`
+	}
+	if err := f.conn.call(ctx, "fs/read_text_file", map[string]any{"sessionId": f.session, "path": abs}, &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Content), nil
+}
+
+func (f *clientFS) WriteFile(ctx context.Context, path string, data []byte, perm os.FileMode) error {
+	if !f.cap.WriteTextFile {
+		return os.WriteFile(path, data, perm)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return f.conn.call(ctx, "fs/write_text_file", map[string]any{"sessionId": f.session, "path": abs, "content": string(data)}, nil)
+}
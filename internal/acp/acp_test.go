@@ -0,0 +1,37 @@
+package acp
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/msg"
+)
+
+func TestNewSessionKeepsOneWorkingDirectory(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	t.Chdir(t.TempDir())
+	s := New(nil, nil, msg.NewBus(t.TempDir()))
+
+	newSession := func(cwd string) error {
+		params, _ := json.Marshal(map[string]string{"cwd": cwd})
+		_, err := s.newSession(params)
+		return err
+	}
+
+	if err := newSession(first); err != nil {
+		t.Fatal(err)
+	}
+	if wd, _ := os.Getwd(); wd != first {
+		t.Fatalf("working directory = %s, want %s", wd, first)
+	}
+	if err := newSession(second); err == nil {
+		t.Error("second session moved to another directory, want an error")
+	}
+	if wd, _ := os.Getwd(); wd != first {
+		t.Errorf("working directory changed to %s", wd)
+	}
+	if err := newSession(first); err != nil {
+		t.Errorf("session in the same directory: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package acp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// JSON-RPC error codes
+const (
+	codeInvalidParams  = -32602
+	codeMethodNotFound = -32601
+	codeInternal       = -32603
+)
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// message is any JSON-RPC 2.0 message: a request, a notification (no ID)
+// or a response
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+// handler answers a request or notification from the client. Notifications
+// ignore the result.
+type handler func(ctx context.Context, method string, params json.RawMessage) (any, error)
+
+// conn is a JSON-RPC connection over newline-delimited JSON, where both
+// sides send requests
+type conn struct {
+	r      *bufio.Reader
+	w      io.Writer
+	handle handler
+
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan message
+}
+
+func newConn(r io.Reader, w io.Writer, handle handler) *conn {
+	return &conn{
+		r:       bufio.NewReader(r),
+		w:       w,
+		handle:  handle,
+		pending: make(map[int64]chan message),
+	}
+}
+
+// serve reads messages until the input ends, handling each request in its
+// own goroutine so a long prompt doesn't hold up cancellation
+func (c *conn) serve(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if len(line) > 0 {
+			var m message
+			if jerr := json.Unmarshal(line, &m); jerr != nil {
+				c.send(message{Error: &rpcError{Code: -32700, Message: "parse error: " + jerr.Error()}})
+			} else if m.Method != "" {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.dispatch(ctx, m)
+				}()
+			} else if m.ID != nil {
+				c.deliver(m)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *conn) dispatch(ctx context.Context, m message) {
+	result, err := c.handle(ctx, m.Method, m.Params)
+	if m.ID == nil {
+		return
+	}
+	resp := message{ID: m.ID}
+	if err != nil {
+		var re *rpcError
+		if !errors.As(err, &re) {
+			re = &rpcError{Code: codeInternal, Message: err.Error()}
+		}
+		resp.Error = re
+	} else {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &rpcError{Code: codeInternal, Message: err.Error()}
+		}
+		resp.Result = data
+	}
+	c.send(resp)
+}
+
+func (c *conn) deliver(m message) {
+	var id int64
+	if json.Unmarshal(*m.ID, &id) != nil {
+		return
+	}
+	c.mu.Lock()
+	ch, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if ok {
+		ch <- m
+	}
+}
+
+// call sends a request to the client and decodes its result into out
+func (c *conn) call(ctx context.Context, method string, params, out any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	raw := json.RawMessage(fmt.Sprint(id))
+	if err := c.send(message{ID: &raw, Method: method, Params: mustJSON(params)}); err != nil {
+		c.forget(id)
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, out)
+	}
+}
+
+func (c *conn) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// notify sends a notification to the client
+func (c *conn) notify(method string, params any) error {
+	return c.send(message{Method: method, Params: mustJSON(params)})
+}
+
+func (c *conn) send(m message) error {
+	m.JSONRPC = "2.0"
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
+
+func mustJSON(v any) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
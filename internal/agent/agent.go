@@ -3,57 +3,106 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/diag"
 	"github.com/abcdlsj/otter/internal/event"
+	"github.com/abcdlsj/otter/internal/hook"
 	"github.com/abcdlsj/otter/internal/llm"
 	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/mode"
 	"github.com/abcdlsj/otter/internal/prompt"
+	"github.com/abcdlsj/otter/internal/repomap"
 	"github.com/abcdlsj/otter/internal/tool"
 	"github.com/abcdlsj/otter/internal/types"
 )
 
 type Agent struct {
 	llm      *llm.LLM
+	small    *llm.LLM // titles, summaries and condensing; llm when no small model is set
 	tools    *tool.Set
 	maxSteps int
-	mode     string
+	mode     mode.Mode
+	diag     *diag.Runner
+	hooks    *hook.Runner
+	sub      bool // a task's sub-agent: only tool hooks run
+
+	mu       sync.Mutex          // guards modeLLMs, used from Run and the UI
+	modeLLMs map[string]*llm.LLM // clients for modes that override the model
 }
 
 func New(l *llm.LLM, t *tool.Set) *Agent {
-	return &Agent{
-		llm:      l,
-		tools:    t,
-		maxSteps: config.C.MaxSteps,
-		mode:     "default",
-	}
+	return NewWithMode(l, t, mode.Default())
 }
 
 // NewWithMode creates an agent with a specific mode (e.g., "plan", "explore")
-func NewWithMode(l *llm.LLM, t *tool.Set, mode string) *Agent {
+func NewWithMode(l *llm.LLM, t *tool.Set, m mode.Mode) *Agent {
 	return &Agent{
 		llm:      l,
+		small:    smallLLM(l),
 		tools:    t,
 		maxSteps: config.C.MaxSteps,
-		mode:     mode,
+		mode:     m,
+		diag:     diag.NewRunner(config.C.Diagnostics),
+		hooks:    hook.NewRunner(config.C.Hooks),
+		modeLLMs: make(map[string]*llm.LLM),
 	}
 }
 
-func (a *Agent) Run(ctx context.Context, lg logger.Logger, history []llm.Message, input string) <-chan event.Event {
+// Run answers input, with optional images, after history
+func (a *Agent) Run(ctx context.Context, lg logger.Logger, history []llm.Message, input string, images []types.Image, opts Options) <-chan event.Event {
 	ch := make(chan event.Event, 64)
 
 	go func() {
 		defer close(ch)
 
-		messages := a.buildMessages(ctx, lg, ch, history, input)
-		tools := llm.FromLangchainTools(a.tools.ToLangchain())
+		l, err := a.modeLLM()
+		if err != nil {
+			ch <- event.Event{Type: event.Error, Data: event.ErrorData{Message: err.Error()}}
+			return
+		}
+		if len(images) > 0 && !l.Vision() {
+			ch <- event.Event{Type: event.Error, Data: event.ErrorData{Message: errNoVision.Error()}}
+			return
+		}
+		ctx = tool.WithVision(ctx, l.Vision())
+		input, ok := a.promptHooks(ctx, ch, history, input)
+		if !ok {
+			return
+		}
+		if !a.sub {
+			repomap.Invalidate() // the user may have edited files since the last turn
+		}
+		set := a.toolSet()
+		var spent []types.Usage // every call of the turn, for the totals on Done
+		track := func(u types.Usage, step int) {
+			spent = append(spent, u)
+			ch <- event.Event{Type: event.Usage, Data: event.UsageData{Usage: u, Step: step}}
+		}
+		messages := a.buildMessages(ctx, lg, ch, history, input, images, track)
+		tools := llm.FromLangchainTools(set.ToLangchain())
 		var fullText strings.Builder
 		var newMsgs []event.Message
+		// record keeps a message for Done and sends it right away so an
+		// interrupted turn can still be saved
+		record := func(m event.Message) {
+			newMsgs = append(newMsgs, m)
+			ch <- event.Event{Type: event.Step, Data: event.StepData{Message: m}}
+		}
+
+		budget := a.steps()
+		if opts.MaxSteps > 0 {
+			budget = opts.MaxSteps
+		}
+		guard := newLoopGuard()
 
-		for step := 0; step < a.maxSteps; step++ {
+		for step := 0; step < budget; step++ {
 			select {
 			case <-ctx.Done():
 				ch <- event.Event{Type: event.Error, Data: event.ErrorData{Message: "cancelled"}}
@@ -61,7 +110,7 @@ func (a *Agent) Run(ctx context.Context, lg logger.Logger, history []llm.Message
 			default:
 			}
 
-			resp := a.chat(ctx, lg, messages, tools, ch)
+			resp := a.chat(ctx, lg, l, messages, tools, ch)
 			if resp == nil {
 				return
 			}
@@ -70,67 +119,173 @@ func (a *Agent) Run(ctx context.Context, lg logger.Logger, history []llm.Message
 				fullText.WriteString(resp.Content)
 			}
 
-			newMsgs = append(newMsgs, event.Message{
+			u := l.Usage("chat", resp)
+			track(u, step+1)
+			record(event.Message{
 				Role:      "assistant",
 				Content:   resp.Content,
 				ToolCalls: resp.ToolCalls,
+				Usage:     []types.Usage{u},
+
+				ReasoningItems: resp.ReasoningItems,
 			})
 
 			messages = append(messages, llm.Message{
 				Role:             "assistant",
 				Content:          resp.Content,
 				ReasoningContent: resp.ReasoningContent,
+				ReasoningItems:   resp.ReasoningItems,
 				ToolCalls:        resp.ToolCalls,
 			})
 
 			if len(resp.ToolCalls) == 0 {
-				ch <- event.Event{Type: event.Done, Data: event.DoneData{
-					FullText:     fullText.String(),
-					InputTokens:  resp.InputTokens,
-					OutputTokens: resp.OutputTokens,
-					Messages:     newMsgs,
-				}}
+				// Messages queued during the last step get an answer in this turn
+				if a.steer(ctx, lg, opts.Queue, ch, &messages, record) {
+					continue
+				}
+				done := event.DoneData{FullText: fullText.String(), Messages: newMsgs}
+				done.InputTokens, done.OutputTokens = types.SumUsage(spent)
+				if !a.sub {
+					a.hooks.Run(ctx, hook.Payload{Event: hook.TurnDone, Done: &done})
+				}
+				ch <- event.Event{Type: event.Done, Data: done}
 				return
 			}
 
-			results := a.runTools(ctx, resp.ToolCalls, ch)
+			results, subs := a.runTools(ctx, lg, set, resp.ToolCalls, ch)
+			spent = append(spent, subs...)
+			pause := guard.observe(resp.ToolCalls, results)
 			if len(results) > 0 {
-				newMsgs = append(newMsgs, event.Message{
+				record(event.Message{
 					Role:        "tool",
 					ToolResults: results,
+					Usage:       subs,
 				})
 				messages = append(messages, llm.Message{
 					Role:        "tool",
 					ToolResults: results,
 				})
 			}
+			if pause != "" {
+				lg.Warn("pausing turn", "reason", pause)
+				ch <- event.Event{Type: event.Paused, Data: event.PausedData{Reason: pause, Steps: step + 1}}
+				return
+			}
+			a.steer(ctx, lg, opts.Queue, ch, &messages, record)
 		}
 
-		ch <- event.Event{Type: event.Error, Data: event.ErrorData{Message: "max steps reached"}}
+		ch <- event.Event{Type: event.Paused, Data: event.PausedData{
+			Reason: fmt.Sprintf("reached the limit of %d steps", budget),
+			Steps:  budget,
+		}}
 	}()
 
 	return ch
 }
 
-func (a *Agent) buildMessages(ctx context.Context, lg logger.Logger, ch chan event.Event, history []llm.Message, input string) []llm.Message {
+const (
+	resumeNote      = "Continue where you left off."
+	interruptedNote = "error: interrupted before the tool returned"
+)
+
+// closeToolCalls adds a result to every tool call left without one by an
+// interrupted turn, as providers reject calls that are never answered
+func closeToolCalls(history []llm.Message) []llm.Message {
+	out := make([]llm.Message, 0, len(history))
+	for i := 0; i < len(history); i++ {
+		m := history[i]
+		out = append(out, m)
+		if m.Role != "assistant" || len(m.ToolCalls) == 0 {
+			continue
+		}
+		results := llm.Message{Role: "tool"}
+		if i+1 < len(history) && history[i+1].Role == "tool" {
+			results = history[i+1]
+			i++
+		}
+		answered := make(map[string]bool, len(results.ToolResults))
+		for _, tr := range results.ToolResults {
+			answered[tr.ToolCallID] = true
+		}
+		results.ToolResults = slices.Clone(results.ToolResults)
+		for _, tc := range m.ToolCalls {
+			if !answered[tc.ID] {
+				results.ToolResults = append(results.ToolResults, types.ToolResult{ToolCallID: tc.ID, Content: interruptedNote})
+			}
+		}
+		out = append(out, results)
+	}
+	return out
+}
+
+// promptHooks runs the session_start and user_prompt_submit hooks, adding
+// their output to input. It reports false when a hook blocked the prompt.
+func (a *Agent) promptHooks(ctx context.Context, ch chan event.Event, history []llm.Message, input string) (string, bool) {
+	if a.sub || input == "" {
+		return input, true
+	}
+	if len(history) == 0 {
+		res := a.hooks.Run(ctx, hook.Payload{Event: hook.SessionStart, Prompt: input})
+		input = hook.Append(input, res.Output)
+	}
+	input, err := a.submitHook(ctx, input)
+	if err != nil {
+		ch <- event.Event{Type: event.Error, Data: event.ErrorData{Message: err.Error()}}
+		return input, false
+	}
+	return input, true
+}
+
+func (a *Agent) submitHook(ctx context.Context, input string) (string, error) {
+	res := a.hooks.Run(ctx, hook.Payload{Event: hook.UserPromptSubmit, Prompt: input})
+	if res.Blocked {
+		return input, errors.New("prompt blocked by hook: " + res.Reason)
+	}
+	return hook.Append(input, res.Output), nil
+}
+
+// steer adds the messages queued while the agent was working as user turns.
+// It reports whether any were added.
+func (a *Agent) steer(ctx context.Context, lg logger.Logger, q *Queue, ch chan event.Event, messages *[]llm.Message, record func(event.Message)) bool {
+	added := false
+	for _, text := range q.Drain() {
+		input, err := a.submitHook(ctx, text)
+		if err != nil {
+			lg.Warn("queued message dropped", "err", err)
+			continue
+		}
+		ch <- event.Event{Type: event.UserMessage, Data: event.UserMessageData{Text: text}}
+		*messages = append(*messages, llm.Message{Role: "user", Content: input})
+		record(event.Message{Role: "user", Content: text})
+		added = true
+	}
+	return added
+}
+
+func (a *Agent) buildMessages(ctx context.Context, lg logger.Logger, ch chan event.Event, history []llm.Message, input string, images []types.Image, track func(types.Usage, int)) []llm.Message {
 	messages := make([]llm.Message, 0, len(history)+2)
 	messages = append(messages, llm.Message{
 		Role:    "system",
 		Content: a.systemPrompt(),
 	})
-	messages = append(messages, history...)
-	messages = append(messages, llm.Message{
-		Role:    "user",
-		Content: input,
-	})
+	messages = append(messages, closeToolCalls(history)...)
+	if input != "" || len(images) > 0 {
+		messages = append(messages, llm.Message{
+			Role:    "user",
+			Content: input,
+			Images:  images,
+		})
+	} else if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+		messages = append(messages, llm.Message{Role: "user", Content: resumeNote})
+	}
 
-	messages = a.maybeCompact(ctx, lg, ch, messages)
+	messages = a.maybeCompact(ctx, lg, ch, messages, track)
 	return messages
 }
 
-func (a *Agent) chat(ctx context.Context, lg logger.Logger, messages []llm.Message, tools []llm.Tool, ch chan event.Event) *llm.Response {
+func (a *Agent) chat(ctx context.Context, lg logger.Logger, l *llm.LLM, messages []llm.Message, tools []llm.Tool, ch chan event.Event) *llm.Response {
 	if config.C.Stream {
-		chunkCh, respCh := a.llm.ChatStream(ctx, lg, messages, tools, nil)
+		chunkCh, respCh := l.ChatStream(ctx, lg, messages, tools, nil)
 		for chunk := range chunkCh {
 			if chunk.Error != nil {
 				ch <- event.Event{Type: event.Error, Data: event.ErrorData{Message: chunk.Error.Error()}}
@@ -143,7 +298,7 @@ func (a *Agent) chat(ctx context.Context, lg logger.Logger, messages []llm.Messa
 		return <-respCh
 	}
 
-	resp, err := a.llm.Chat(ctx, lg, messages, tools, nil)
+	resp, err := l.Chat(ctx, lg, messages, tools, nil)
 	if err != nil {
 		ch <- event.Event{Type: event.Error, Data: event.ErrorData{Message: err.Error()}}
 		return nil
@@ -154,9 +309,14 @@ func (a *Agent) chat(ctx context.Context, lg logger.Logger, messages []llm.Messa
 	return resp
 }
 
-func (a *Agent) runTools(ctx context.Context, calls []types.ToolCall, ch chan event.Event) []types.ToolResult {
-	var results []types.ToolResult
-	for _, tc := range calls {
+// runTools runs calls in order, except task calls, which run concurrently
+// with the rest. It returns the results in call order and the token usage
+// of any sub-agents and condensing.
+func (a *Agent) runTools(ctx context.Context, lg logger.Logger, set *tool.Set, calls []types.ToolCall, ch chan event.Event) ([]types.ToolResult, []types.Usage) {
+	results := make([]types.ToolResult, len(calls))
+	subs := make([][]types.Usage, len(calls))
+	var wg sync.WaitGroup
+	for i, tc := range calls {
 		ch <- event.Event{
 			Type: event.ToolStart,
 			Data: event.ToolStartData{
@@ -166,87 +326,210 @@ func (a *Agent) runTools(ctx context.Context, calls []types.ToolCall, ch chan ev
 			},
 		}
 
-		t := a.tools.Get(tc.Name)
-		if t == nil {
-			a.sendToolEnd(ch, tc.ID, tc.Name, "", "unknown tool")
-			results = append(results, types.ToolResult{
-				ToolCallID: tc.ID,
-				Content:    "error: unknown tool",
-			})
+		if tc.Name == "task" && set.Get(tc.Name) != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], subs[i] = a.callTool(ctx, lg, set, tc, ch)
+			}()
 			continue
 		}
+		results[i], subs[i] = a.callTool(ctx, lg, set, tc, ch)
+	}
+	wg.Wait()
+	return results, slices.Concat(subs...)
+}
 
-		result, err := t.Run(ctx, json.RawMessage(tc.Args))
+// callTool runs one call between its pre_tool and post_tool hooks and
+// reports its end
+func (a *Agent) callTool(ctx context.Context, lg logger.Logger, set *tool.Set, tc types.ToolCall, ch chan event.Event) (types.ToolResult, []types.Usage) {
+	if t := set.Get(tc.Name); t != nil {
+		args, repairs, err := tool.CheckArgs(t, json.RawMessage(tc.Args))
 		if err != nil {
-			a.sendToolEnd(ch, tc.ID, tc.Name, "", err.Error())
-			results = append(results, types.ToolResult{
-				ToolCallID: tc.ID,
-				Content:    "error: " + err.Error(),
-			})
-			continue
+			lg.Info("invalid tool arguments", "tool", tc.Name, "err", err)
+			res, end := toolError(tc, err.Error())
+			ch <- event.Event{Type: event.ToolEnd, Data: end}
+			return res, nil
 		}
-
-		if len(result) > maxToolResultLen {
-			result = result[:maxToolResultLen] + "\n... (truncated)"
+		if len(repairs) > 0 {
+			lg.Info("repaired tool arguments", "tool", tc.Name, "repairs", strings.Join(repairs, "; "))
+			tc.Args = string(args)
+		}
+		if approve := tool.ApprovalFrom(ctx); approve != nil && tool.NeedsApproval(tc.Name, args) {
+			if err := approve(ctx, tc); err != nil {
+				lg.Info("tool call not approved", "tool", tc.Name, "reason", err)
+				res, end := toolError(tc, err.Error())
+				ch <- event.Event{Type: event.ToolEnd, Data: end}
+				return res, nil
+			}
 		}
+	}
 
-		a.sendToolEnd(ch, tc.ID, tc.Name, result, "")
-		results = append(results, types.ToolResult{
-			ToolCallID: tc.ID,
-			Content:    result,
-		})
+	start := event.ToolStartData{ID: tc.ID, Name: tc.Name, Args: tc.Args}
+	pre := a.hooks.Run(ctx, hook.Payload{Event: hook.PreTool, Tool: &start})
+	if pre.Blocked {
+		lg.Info("tool blocked by hook", "tool", tc.Name, "reason", pre.Reason)
+		res, end := toolError(tc, "blocked by hook: "+pre.Reason)
+		ch <- event.Event{Type: event.ToolEnd, Data: end}
+		return res, nil
+	}
+
+	var (
+		res types.ToolResult
+		end event.ToolEndData
+		u   []types.Usage
+	)
+	if tc.Name == "task" && set.Get(tc.Name) != nil {
+		res, end, u = a.runTask(ctx, lg, set, tc, ch)
+	} else {
+		res, end, u = a.runTool(ctx, lg, set, tc, ch)
+	}
+
+	post := a.hooks.Run(ctx, hook.Payload{Event: hook.PostTool, Tool: &start, Result: &end})
+	if out := strings.TrimSpace(pre.Output + "\n" + post.Output); out != "" {
+		res.Content = hook.Append(res.Content, out)
+		if end.Error == "" {
+			end.Result = hook.Append(end.Result, out)
+		}
 	}
-	return results
+	ch <- event.Event{Type: event.ToolEnd, Data: end}
+	return res, u
+}
+
+func toolError(tc types.ToolCall, msg string) (types.ToolResult, event.ToolEndData) {
+	return types.ToolResult{ToolCallID: tc.ID, Content: "error: " + msg},
+		event.ToolEndData{ID: tc.ID, Name: tc.Name, Error: msg}
 }
 
-func (a *Agent) sendToolEnd(ch chan event.Event, id, name, result, err string) {
-	ch <- event.Event{
-		Type: event.ToolEnd,
-		Data: event.ToolEndData{
-			ID:     id,
-			Name:   name,
-			Result: result,
-			Error:  err,
-		},
+func (a *Agent) runTool(ctx context.Context, lg logger.Logger, set *tool.Set, tc types.ToolCall, ch chan event.Event) (types.ToolResult, event.ToolEndData, []types.Usage) {
+	t := set.Get(tc.Name)
+	if t == nil {
+		res, end := toolError(tc, "unknown tool")
+		return res, end, nil
 	}
+
+	var u []types.Usage
+	ctx = tool.WithCondense(ctx, func(ctx context.Context, prompt, content string) (string, error) {
+		answer, cu, err := a.condense(ctx, lg, tc.Name, prompt, content)
+		if err == nil {
+			u = append(u, cu)
+			ch <- event.Event{Type: event.Usage, Data: event.UsageData{Usage: cu}, Parent: tc.ID}
+		}
+		return answer, err
+	})
+	res, err := tool.Execute(ctx, t, json.RawMessage(tc.Args))
+	if err != nil {
+		res, end := toolError(tc, err.Error())
+		return res, end, u
+	}
+
+	result := a.fitResult(lg, t, tc, res.Output)
+	if len(res.Diffs) > 0 {
+		repomap.Invalidate()
+		if report := a.diag.Check(ctx, res.Diffs); report != "" {
+			lg.Info("new diagnostics after write", "tool", tc.Name)
+			result += "\n\n" + report
+		}
+	}
+
+	return types.ToolResult{
+		ToolCallID: tc.ID,
+		Content:    result,
+		Images:     res.Images,
+	}, event.ToolEndData{
+		ID:     tc.ID,
+		Name:   tc.Name,
+		Result: result,
+		Diffs:  res.Diffs,
+	}, u
 }
 
-func (a *Agent) GenerateTitle(ctx context.Context, lg logger.Logger, text string) (string, error) {
+// GenerateTitle names a conversation from its first message and reports
+// the tokens the call used
+func (a *Agent) GenerateTitle(ctx context.Context, lg logger.Logger, text string) (string, types.Usage, error) {
 	messages := []llm.Message{
 		{Role: "system", Content: "Generate a very short title (max 15 chars) for this conversation in English. Reply with ONLY the title, no quotes, no explanation."},
 		{Role: "user", Content: text},
 	}
-	resp, err := a.llm.Chat(ctx, lg, messages, nil, nil)
+	resp, err := a.small.Chat(ctx, lg, messages, nil, nil)
 	if err != nil {
-		return "", err
+		return "", types.Usage{}, err
 	}
 	title := types.TruncateRunes(strings.TrimSpace(resp.Content), maxTitleLen)
-	return title, nil
+	return title, a.small.Usage("title", resp), nil
 }
 
 const (
-	compactThreshold   = 60000
-	compactKeepRecent  = 6
-	maxToolResultLen   = 4000
-	maxTitleLen        = 20
-	maxSummaryContent  = 500
+	compactThreshold  = 60000
+	compactKeepRecent = 6
+	maxTitleLen       = 20
+	maxSummaryContent = 500
 )
 
 func (a *Agent) systemPrompt() string {
-	return prompt.Load(a.tools, a.maxSteps, a.mode)
+	return prompt.Load(a.toolSet(), a.mode)
 }
 
 // SetMode changes the agent's mode dynamically
-func (a *Agent) SetMode(mode string) {
-	a.mode = mode
+func (a *Agent) SetMode(m mode.Mode) {
+	a.mode = m
 }
 
 // Mode returns the current mode
-func (a *Agent) Mode() string {
+func (a *Agent) Mode() mode.Mode {
 	return a.mode
 }
 
-func (a *Agent) maybeCompact(ctx context.Context, lg logger.Logger, ch chan event.Event, messages []llm.Message) []llm.Message {
+var errNoVision = errors.New("the current model does not accept images; set vision = true on a model that does, or switch models")
+
+// CheckImages reports an error when the current mode's model can't take images
+func (a *Agent) CheckImages() error {
+	l, err := a.modeLLM()
+	if err != nil {
+		return err
+	}
+	if !l.Vision() {
+		return errNoVision
+	}
+	return nil
+}
+
+// toolSet returns the tools the current mode may use
+func (a *Agent) toolSet() *tool.Set {
+	if len(a.mode.Tools) == 0 {
+		return a.tools
+	}
+	return a.tools.Subset(a.mode.Tools)
+}
+
+func (a *Agent) steps() int {
+	if a.mode.MaxSteps > 0 {
+		return a.mode.MaxSteps
+	}
+	return a.maxSteps
+}
+
+// modeLLM returns the client for the current mode's model and params
+func (a *Agent) modeLLM() (*llm.LLM, error) {
+	l := a.llm
+	if ref := a.mode.Model; ref != "" {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		cached, ok := a.modeLLMs[ref]
+		if !ok {
+			var err error
+			cached, err = llm.NewFor(ref)
+			if err != nil {
+				return nil, fmt.Errorf("mode %s: %w", a.mode.Name, err)
+			}
+			a.modeLLMs[ref] = cached
+		}
+		l = cached
+	}
+	return l.WithParams(llm.Params(a.mode.Params)), nil
+}
+
+func (a *Agent) maybeCompact(ctx context.Context, lg logger.Logger, ch chan event.Event, messages []llm.Message, track func(types.Usage, int)) []llm.Message {
 	tokens := llm.EstimateMessagesTokens(messages, config.C.CurrentModelName())
 	if tokens < compactThreshold {
 		return messages
@@ -266,11 +549,12 @@ func (a *Agent) maybeCompact(ctx context.Context, lg logger.Logger, ch chan even
 	recent := messages[len(messages)-compactKeepRecent:]
 	toCompact := messages[1 : len(messages)-compactKeepRecent]
 
-	summary, err := a.summarize(ctx, lg, toCompact)
+	summary, u, err := a.summarize(ctx, lg, toCompact)
 	if err != nil {
 		lg.Warn("compact failed, using full history", "err", err)
 		return messages
 	}
+	track(u, 0)
 
 	result := make([]llm.Message, 0, compactKeepRecent+2)
 	result = append(result, sys)
@@ -285,11 +569,12 @@ func (a *Agent) maybeCompact(ctx context.Context, lg logger.Logger, ch chan even
 	ch <- event.Event{Type: event.CompactEnd, Data: event.CompactEndData{
 		Before: tokens,
 		After:  newTokens,
+		Usage:  &u,
 	}}
 	return result
 }
 
-func (a *Agent) summarize(ctx context.Context, lg logger.Logger, messages []llm.Message) (string, error) {
+func (a *Agent) summarize(ctx context.Context, lg logger.Logger, messages []llm.Message) (string, types.Usage, error) {
 	var sb strings.Builder
 	for _, m := range messages {
 		sb.WriteString(fmt.Sprintf("[%s]: %s\n", m.Role, m.Content))
@@ -313,9 +598,9 @@ func (a *Agent) summarize(ctx context.Context, lg logger.Logger, messages []llm.
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	resp, err := a.llm.Chat(ctx, lg, prompt, nil, nil)
+	resp, err := a.small.Chat(ctx, lg, prompt, nil, nil)
 	if err != nil {
-		return "", err
+		return "", types.Usage{}, err
 	}
-	return strings.TrimSpace(resp.Content), nil
+	return strings.TrimSpace(resp.Content), a.small.Usage("compact", resp), nil
 }
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/event"
+	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/tool"
+)
+
+func TestRunToolCallThenAnswer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("otters hold hands\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := llm.NewScriptedProvider(
+		llm.CallTool("view", `{"path": "`+path+`"}`),
+		func(messages []llm.Message, _ []llm.Tool) (*llm.Response, error) {
+			last := messages[len(messages)-1]
+			if last.Role != "tool" || len(last.ToolResults) != 1 || !strings.Contains(last.ToolResults[0].Content, "otters hold hands") {
+				t.Errorf("second call got %+v, want the view result", last)
+			}
+			return llm.Reply("They hold hands.")(messages, nil)
+		},
+	)
+	a := New(llm.NewWithProvider(p, "fake/m", false), tool.NewSet())
+
+	var done *event.DoneData
+	var toolEnds int
+	for ev := range a.Run(context.Background(), logger.NewFileLogger(dir), nil, "What do otters do?", nil, Options{MaxSteps: 5}) {
+		switch ev.Type {
+		case event.ToolEnd:
+			toolEnds++
+			if data := ev.Data.(event.ToolEndData); data.Name != "view" || data.Error != "" {
+				t.Errorf("tool end = %+v", data)
+			}
+		case event.Error:
+			t.Fatalf("error event: %+v", ev.Data)
+		case event.Done:
+			data := ev.Data.(event.DoneData)
+			done = &data
+		}
+	}
+
+	if toolEnds != 1 {
+		t.Errorf("got %d tool ends, want 1", toolEnds)
+	}
+	if done == nil {
+		t.Fatal("turn ended without Done")
+	}
+	if done.FullText != "They hold hands." {
+		t.Errorf("full text = %q", done.FullText)
+	}
+	roles := make([]string, len(done.Messages))
+	for i, m := range done.Messages {
+		roles[i] = m.Role
+	}
+	if got := strings.Join(roles, ","); got != "assistant,tool,assistant" {
+		t.Errorf("recorded roles = %s, want assistant,tool,assistant", got)
+	}
+	if n := p.Remaining(); n != 0 {
+		t.Errorf("%d scripted steps unused", n)
+	}
+}
+
+func TestTaskSubAgentIsReadOnly(t *testing.T) {
+	var childTools []string
+	p := llm.NewScriptedProvider(
+		llm.CallTool("task", `{"description": "find otters", "prompt": "Where are the otters?"}`),
+		func(messages []llm.Message, tools []llm.Tool) (*llm.Response, error) {
+			for _, tl := range tools {
+				childTools = append(childTools, tl.Name)
+			}
+			return llm.Reply("In the river.")(messages, tools)
+		},
+		llm.Reply("They are in the river."),
+	)
+	a := New(llm.NewWithProvider(p, "fake/m", false), tool.NewSet())
+	for ev := range a.Run(context.Background(), logger.NewFileLogger(t.TempDir()), nil, "Find the otters", nil, Options{MaxSteps: 5}) {
+		if ev.Type == event.Error {
+			t.Fatalf("error event: %+v", ev.Data)
+		}
+	}
+
+	if len(childTools) == 0 {
+		t.Fatal("sub-agent got no tools")
+	}
+	for _, name := range childTools {
+		if !slices.Contains(tool.ReadOnly, name) {
+			t.Errorf("explore sub-agent got %s, want read-only tools only", name)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const (
+	loopNudgeAt = 3 // repeats before the model is told it's going in circles
+	loopPauseAt = 5 // repeats before the turn pauses for the user
+)
+
+// loopGuard notices a model going in circles: making a call again and
+// getting the same result back, or retrying a tool that keeps failing the
+// same way
+type loopGuard struct {
+	calls map[string]streak // by tool and normalized arguments
+	errs  map[string]streak // by tool
+}
+
+type streak struct {
+	last  string
+	count int
+}
+
+func newLoopGuard() *loopGuard {
+	return &loopGuard{calls: make(map[string]streak), errs: make(map[string]streak)}
+}
+
+// observe counts a step's calls. Results of calls that repeat too often get a
+// note telling the model to change course; the returned reason is set when
+// that has stopped helping and the turn should pause.
+func (g *loopGuard) observe(calls []types.ToolCall, results []types.ToolResult) string {
+	pause := ""
+	for i, tc := range calls {
+		if i >= len(results) {
+			break
+		}
+		res := &results[i]
+
+		key := tc.Name + " " + normalizeArgs(tc.Args)
+		call := bump(g.calls, key, res.Content)
+
+		failed := strings.HasPrefix(res.Content, "error: ")
+		errs := 0
+		if failed {
+			errs = bump(g.errs, tc.Name, firstLine(res.Content))
+		} else {
+			delete(g.errs, tc.Name)
+		}
+
+		switch {
+		case errs >= loopNudgeAt:
+			res.Content += fmt.Sprintf("\n\nnote: %s has failed with this error %d times in a row. Don't retry it as is: read the error, change the arguments or the approach, or explain to the user what is blocking you.", tc.Name, errs)
+			if errs >= loopPauseAt {
+				pause = fmt.Sprintf("%s failed with the same error %d times in a row", tc.Name, errs)
+			}
+		case call >= loopNudgeAt:
+			res.Content += fmt.Sprintf("\n\nnote: this is call %d to %s with these arguments, and the result hasn't changed. Repeating it won't help: use what you already have, try something else, or ask the user.", call, tc.Name)
+			if call >= loopPauseAt {
+				pause = fmt.Sprintf("%s repeated the same call %d times without progress", tc.Name, call)
+			}
+		}
+	}
+	return pause
+}
+
+// bump extends key's streak when value matches its last one, or restarts it
+func bump(m map[string]streak, key, value string) int {
+	s := m[key]
+	if s.count > 0 && s.last == value {
+		s.count++
+	} else {
+		s = streak{last: value, count: 1}
+	}
+	m[key] = s
+	return s.count
+}
+
+// normalizeArgs makes calls that differ only in key order or spacing compare
+// equal
+func normalizeArgs(args string) string {
+	var v any
+	if err := json.Unmarshal([]byte(args), &v); err != nil {
+		return strings.Join(strings.Fields(args), " ")
+	}
+	v = collapseSpace(v)
+	b, _ := json.Marshal(v) // maps marshal with sorted keys
+	return string(b)
+}
+
+func collapseSpace(v any) any {
+	switch x := v.(type) {
+	case string:
+		return strings.Join(strings.Fields(x), " ")
+	case map[string]any:
+		for k, e := range x {
+			x[k] = collapseSpace(e)
+		}
+	case []any:
+		for i, e := range x {
+			x[i] = collapseSpace(e)
+		}
+	}
+	return v
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return types.TruncateRunes(line, 200)
+}
@@ -0,0 +1,73 @@
+package agent
+
+import "sync"
+
+// Options tune a single Run
+type Options struct {
+	// Queue holds messages the user sent while the run was in progress.
+	// They are added as user turns between steps.
+	Queue *Queue
+	// MaxSteps overrides the step budget of the agent's mode, as when the
+	// user continues a paused turn
+	MaxSteps int
+}
+
+// Queue is a list of pending user messages, safe to use from the TUI
+// while the agent drains it
+type Queue struct {
+	mu    sync.Mutex
+	items []string
+}
+
+func NewQueue() *Queue {
+	return &Queue{}
+}
+
+func (q *Queue) Push(text string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, text)
+}
+
+// Pop removes and returns the most recently queued message
+func (q *Queue) Pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return "", false
+	}
+	text := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return text, true
+}
+
+// Drain removes and returns all queued messages in order
+func (q *Queue) Drain() []string {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// Items returns a copy of the queued messages
+func (q *Queue) Items() []string {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.items...)
+}
+
+func (q *Queue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const (
+	maxCondenseContent = 100000
+	maxCommitDiff      = 30000
+)
+
+// smallLLM returns the client for the configured small model, or l when
+// none is set or it can't be created
+func smallLLM(l *llm.LLM) *llm.LLM {
+	ref := config.C.SmallModelRef()
+	if ref == "" {
+		return l
+	}
+	small, err := llm.NewFor(ref)
+	if err != nil {
+		logger.Warn("small model unavailable, using the main model", "model", ref, "err", err)
+		return l
+	}
+	return small
+}
+
+// SmallModel returns the provider/model used for auxiliary calls
+func (a *Agent) SmallModel() string { return a.small.Model() }
+
+// condense answers prompt from content a tool fetched, so the main model
+// reads the answer instead of the whole page
+func (a *Agent) condense(ctx context.Context, lg logger.Logger, kind, prompt, content string) (string, types.Usage, error) {
+	messages := []llm.Message{
+		{Role: "system", Content: "You read content fetched for another agent and answer its request. Use only the content. Quote code, commands, versions and URLs exactly. If the content doesn't answer the request, say so and summarize what it does contain. Be concise."},
+		{Role: "user", Content: fmt.Sprintf("Request: %s\n\nContent:\n%s", prompt, types.TruncateRunes(content, maxCondenseContent))},
+	}
+	resp, err := a.small.Chat(ctx, lg, messages, nil, nil)
+	if err != nil {
+		return "", types.Usage{}, err
+	}
+	lg.Info("condensed tool output", "tool", kind, "before", len(content), "after", len(resp.Content))
+	return strings.TrimSpace(resp.Content), a.small.Usage(kind, resp), nil
+}
+
+// CommitMessage writes a commit message for a staged diff, following hint
+// when given
+func (a *Agent) CommitMessage(ctx context.Context, lg logger.Logger, diff, hint string) (string, types.Usage, error) {
+	var sb strings.Builder
+	if hint != "" {
+		fmt.Fprintf(&sb, "Instructions: %s\n\n", hint)
+	}
+	sb.WriteString("Staged diff:\n")
+	sb.WriteString(types.TruncateRunes(diff, maxCommitDiff))
+	messages := []llm.Message{
+		{Role: "system", Content: "Write a git commit message for the staged diff: a summary line in the imperative mood of at most 72 characters, then, if the change needs it, a blank line and a short body explaining what changed and why. Reply with ONLY the message, no quotes or code fences."},
+		{Role: "user", Content: sb.String()},
+	}
+	resp, err := a.small.Chat(ctx, lg, messages, nil, nil)
+	if err != nil {
+		return "", types.Usage{}, err
+	}
+	text := strings.TrimSpace(resp.Content)
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```"))
+	if text == "" {
+		return "", types.Usage{}, fmt.Errorf("the model returned an empty commit message")
+	}
+	return text, a.small.Usage("commit", resp), nil
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/event"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/mode"
+	"github.com/abcdlsj/otter/internal/tool"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const defaultTaskSteps = 30
+
+const taskReportNote = "\n\nYou are running as a sub-agent. Nobody sees your intermediate messages: when done, reply with a concise, self-contained report of your findings (with file:line references) for the agent that delegated this task."
+
+// runTask runs a task call on a child agent with a fresh history. The
+// child's tool events are forwarded under the task call; its final text
+// becomes the tool result.
+func (a *Agent) runTask(ctx context.Context, lg logger.Logger, set *tool.Set, tc types.ToolCall, ch chan event.Event) (types.ToolResult, event.ToolEndData, []types.Usage) {
+	fail := func(msg string) (types.ToolResult, event.ToolEndData, []types.Usage) {
+		res, end := toolError(tc, msg)
+		return res, end, nil
+	}
+
+	args, err := tool.ParseTaskArgs(json.RawMessage(tc.Args))
+	if err != nil {
+		return fail(err.Error())
+	}
+	m, ok := mode.Find(args.Mode)
+	if !ok {
+		return fail(fmt.Sprintf("unknown mode %q", args.Mode))
+	}
+	if args.MaxSteps > 0 {
+		m.MaxSteps = args.MaxSteps
+	}
+
+	// Tasks run concurrently, so write tools only go to modes that list
+	// them, and sub-agents can't start further tasks
+	names := m.Tools
+	if len(names) == 0 {
+		names = tool.ReadOnly
+	}
+	child := NewWithMode(a.llm, set.Subset(names).Without("task"), m)
+	child.maxSteps = defaultTaskSteps
+	child.diag = a.diag
+	child.hooks = a.hooks
+	child.small = a.small
+	child.sub = true
+
+	lg.Info("task start", "id", tc.ID, "mode", m.Name, "description", args.Description)
+	var (
+		u       []types.Usage
+		text    strings.Builder
+		report  string
+		done    bool
+		errText string
+	)
+	for ev := range child.Run(ctx, lg, nil, args.Prompt+taskReportNote, nil, Options{}) {
+		switch ev.Type {
+		case event.ToolStart, event.ToolEnd:
+			if ev.Parent == "" {
+				ev.Parent = tc.ID
+			}
+			ch <- ev
+		case event.Usage:
+			if data, ok := ev.Data.(event.UsageData); ok {
+				data.Usage.Kind = "task"
+				u = append(u, data.Usage)
+				ch <- event.Event{Type: event.Usage, Data: data, Parent: tc.ID}
+			}
+		case event.TextDelta:
+			if data, ok := ev.Data.(event.TextDeltaData); ok {
+				text.WriteString(data.Text)
+			}
+		case event.Done:
+			if data, ok := ev.Data.(event.DoneData); ok {
+				// Only the last answer is the report, not the narration before tool calls
+				if n := len(data.Messages); n > 0 {
+					report = data.Messages[n-1].Content
+				}
+			}
+			done = true
+		case event.Error:
+			if data, ok := ev.Data.(event.ErrorData); ok {
+				errText = data.Message
+			}
+		case event.Paused:
+			if data, ok := ev.Data.(event.PausedData); ok {
+				errText = data.Reason
+			}
+		}
+	}
+	lg.Info("task end", "id", tc.ID, "done", done, "err", errText)
+
+	if !done {
+		if errText == "" {
+			errText = "sub-agent stopped"
+		}
+		msg := "task failed: " + errText
+		if partial := strings.TrimSpace(text.String()); partial != "" {
+			msg += "\n\nPartial output:\n" + partial
+		}
+		res, end, _ := fail(msg)
+		return res, end, u
+	}
+
+	report = strings.TrimSpace(report)
+	if report == "" {
+		report = "(sub-agent finished without a report)"
+	}
+	report = a.fitResult(lg, set.Get(tc.Name), tc, report)
+	return types.ToolResult{ToolCallID: tc.ID, Content: report},
+		event.ToolEndData{ID: tc.ID, Name: tc.Name, Result: report}, u
+}
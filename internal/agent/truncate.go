@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/tool"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const (
+	toolResultContextShare = 32 // each tool result may use 1/32 of the context window
+	minToolResultTokens    = 1000
+	maxToolResultTokens    = 16000
+	spillNoteTokens        = 80
+)
+
+// toolResultBudget scales the per-result token budget with the model's context window
+func toolResultBudget() int {
+	n := config.C.CurrentModel().ContextTokens() / toolResultContextShare
+	return min(max(n, minToolResultTokens), maxToolResultTokens)
+}
+
+// fitResult shrinks a tool result that exceeds the budget. The tool picks
+// what to keep, the full output goes to a spill file the model can read.
+func (a *Agent) fitResult(lg logger.Logger, t tool.Tool, tc types.ToolCall, result string) string {
+	model := config.C.CurrentModelName()
+	count := func(s string) int { return int(llm.EstimateTokens(s, model)) }
+
+	budget := toolResultBudget()
+	total := count(result)
+	if total <= budget {
+		return result
+	}
+
+	out := tool.Truncate(t, result, tool.Budget{Tokens: budget - spillNoteTokens, Count: count})
+	path, err := spill(tc, result)
+	if err != nil {
+		lg.Warn("spill tool result failed", "tool", tc.Name, "err", err)
+		return out + fmt.Sprintf("\n\n[Output truncated from %d tokens]", total)
+	}
+	lg.Info("tool result truncated", "tool", tc.Name, "tokens", total, "budget", budget, "spill", path)
+	return out + fmt.Sprintf("\n\n[Output truncated from %d tokens. Full output saved to %s; use view with view_range or grep on that file to read the rest]", total, path)
+}
+
+func spill(tc types.ToolCall, result string) (string, error) {
+	dir := config.SpillDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	id := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, tc.ID)
+	name := fmt.Sprintf("%s_%s_%s.txt", time.Now().Format("20060102_150405"), tc.Name, id)
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, []byte(result), 0644)
+}
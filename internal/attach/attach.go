@@ -0,0 +1,221 @@
+package attach
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/media"
+	"github.com/abcdlsj/otter/internal/tool"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const (
+	maxFileBytes  = 128 * 1024
+	maxDirEntries = 200
+	maxURLChars   = 50000
+)
+
+var mentionRe = regexp.MustCompile(`(?:^|\s)@(\S+)`)
+
+// Mentions returns the @refs in text in order, without duplicates
+func Mentions(text string) []string {
+	var refs []string
+	for _, m := range mentionRe.FindAllStringSubmatch(text, -1) {
+		ref := trimRef(m[1])
+		if media.IsImage(ref) {
+			continue // sent as an image, see ImagePaths
+		}
+		if ref != "" && !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// ImagePaths returns the image files referenced in text, as @image.png or
+// as a plain path such as one pasted from a file manager
+func ImagePaths(text string) []string {
+	var paths []string
+	for _, word := range strings.Fields(text) {
+		path := trimRef(strings.Trim(strings.TrimPrefix(word, "@"), `"'`))
+		if !media.IsImage(path) || IsURL(path) {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, _ := os.UserHomeDir()
+			path = filepath.Join(home, rest)
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() || slices.Contains(paths, path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// trimRef drops punctuation that ends a sentence rather than the mention
+func trimRef(ref string) string {
+	return strings.TrimRight(ref, ".,;:!?)\"'")
+}
+
+// IsURL reports whether ref is fetched over HTTP rather than read from disk
+func IsURL(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+// Resolve loads what a mention refers to: a URL, a directory, a file or a
+// line range of a file written as path:10-40 (or path:10)
+func Resolve(ctx context.Context, ref string) (types.Attachment, error) {
+	var a types.Attachment
+	var err error
+	if IsURL(ref) {
+		a, err = resolveURL(ctx, ref)
+	} else {
+		a, err = resolvePath(ref)
+	}
+	if err != nil {
+		return types.Attachment{}, err
+	}
+	a.Ref = ref
+	a.Tokens = llm.EstimateTokens(a.Content, config.C.CurrentModelName())
+	return a, nil
+}
+
+func resolveURL(ctx context.Context, ref string) (types.Attachment, error) {
+	args, _ := json.Marshal(map[string]any{"url": ref, "maxChars": maxURLChars})
+	out, err := tool.WebFetch{}.Run(ctx, args)
+	if err != nil {
+		return types.Attachment{}, err
+	}
+	return types.Attachment{Kind: "url", Path: ref, Content: strings.TrimSpace(out)}, nil
+}
+
+func resolvePath(ref string) (types.Attachment, error) {
+	path, start, end := splitRange(ref)
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.Attachment{}, fmt.Errorf("%s: no such file or directory", path)
+	}
+	if !config.C.CheckReadPermission(path) {
+		return types.Attachment{}, fmt.Errorf("permission denied: cannot read %s", path)
+	}
+
+	if info.IsDir() {
+		return types.Attachment{Kind: "dir", Path: path, Content: listDir(path)}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.Attachment{}, err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return types.Attachment{}, fmt.Errorf("%s is a binary file", path)
+	}
+
+	a := types.Attachment{Kind: "file", Path: path}
+	content := string(data)
+	if start > 0 {
+		lines := strings.Split(content, "\n")
+		if start > len(lines) {
+			return types.Attachment{}, fmt.Errorf("%s has only %d lines", path, len(lines))
+		}
+		end = min(max(end, start), len(lines))
+		a.Start, a.End = start, end
+		content = strings.Join(lines[start-1:end], "\n")
+	}
+	if len(content) > maxFileBytes {
+		// Cut at the last full line, or at least on a rune boundary
+		n := maxFileBytes
+		if i := strings.LastIndexByte(content[:n], '\n'); i > 0 {
+			n = i
+		}
+		for n > 0 && !utf8.RuneStart(content[n]) {
+			n--
+		}
+		content = content[:n] + "\n[truncated]"
+	}
+	a.Content = strings.TrimRight(content, "\n")
+	return a, nil
+}
+
+// splitRange splits "path:10-40" or "path:10" into its parts. Without a
+// valid range the whole ref is the path.
+func splitRange(ref string) (path string, start, end int) {
+	i := strings.LastIndexByte(ref, ':')
+	if i < 0 {
+		return ref, 0, 0
+	}
+	from, to, isRange := strings.Cut(ref[i+1:], "-")
+	s, err := strconv.Atoi(from)
+	if err != nil || s < 1 {
+		return ref, 0, 0
+	}
+	e := s
+	if isRange {
+		if e, err = strconv.Atoi(to); err != nil {
+			return ref, 0, 0
+		}
+	}
+	return ref[:i], s, e
+}
+
+func listDir(dir string) string {
+	files := Files(dir)
+	var sb strings.Builder
+	for i, f := range files {
+		if i == maxDirEntries {
+			fmt.Fprintf(&sb, "... and %d more\n", len(files)-maxDirEntries)
+			break
+		}
+		sb.WriteString(filepath.ToSlash(filepath.Join(dir, f)) + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Label is the short form of an attachment shown in the TUI
+func Label(a types.Attachment) string {
+	switch {
+	case a.Kind == "dir":
+		return strings.TrimSuffix(filepath.ToSlash(a.Path), "/") + "/"
+	case a.Start > 0:
+		return fmt.Sprintf("%s:%d-%d", filepath.ToSlash(a.Path), a.Start, a.End)
+	}
+	return filepath.ToSlash(a.Path)
+}
+
+// Render formats attachments as blocks for the model
+func Render(atts []types.Attachment) string {
+	var sb strings.Builder
+	for _, a := range atts {
+		switch {
+		case a.Kind == "url":
+			fmt.Fprintf(&sb, "\n\n<attachment url=%q>\n%s\n</attachment>", a.Path, a.Content)
+		case a.Kind == "dir":
+			fmt.Fprintf(&sb, "\n\n<attachment dir=%q>\n%s\n</attachment>", Label(a), a.Content)
+		case a.Start > 0:
+			fmt.Fprintf(&sb, "\n\n<attachment path=%q lines=\"%d-%d\">\n%s\n</attachment>", filepath.ToSlash(a.Path), a.Start, a.End, a.Content)
+		default:
+			fmt.Fprintf(&sb, "\n\n<attachment path=%q>\n%s\n</attachment>", filepath.ToSlash(a.Path), a.Content)
+		}
+	}
+	return sb.String()
+}
+
+// Content is a user message as sent to the model: the text followed by its attachments
+func Content(text string, atts []types.Attachment) string {
+	if len(atts) == 0 {
+		return text
+	}
+	return text + Render(atts)
+}
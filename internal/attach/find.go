@@ -0,0 +1,118 @@
+package attach
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/workspace"
+)
+
+const maxFiles = 20000
+
+// Files lists the files under root that may be attached, relative to root.
+// In a git repo .gitignore is honoured; DenyRead paths are always left out.
+func Files(root string) []string {
+	files := workspace.Files(root, maxFiles, func(rel string) bool {
+		return config.C.CheckReadPermission(filepath.Join(root, rel))
+	})
+	slices.Sort(files)
+	return files
+}
+
+// Candidates returns files plus the directories containing them, which end in "/"
+func Candidates(files []string) []string {
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(files))
+	for _, f := range files {
+		f = filepath.ToSlash(f)
+		for dir := filepath.ToSlash(filepath.Dir(f)); dir != "." && !seen[dir]; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			seen[dir] = true
+			out = append(out, dir+"/")
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// Find returns up to limit candidates matching query as a fuzzy
+// subsequence, best first: contiguous runs, matches at word starts and in
+// the base name score higher, gaps and long paths lower
+func Find(query string, candidates []string, limit int) []string {
+	type scored struct {
+		path  string
+		score int
+	}
+	var matches []scored
+	for _, c := range candidates {
+		if s, ok := fuzzyScore(query, c); ok {
+			matches = append(matches, scored{c, s})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b scored) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return len(a.path) - len(b.path)
+	})
+
+	out := make([]string, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		out = append(out, m.path)
+	}
+	return out
+}
+
+// fuzzyScore matches query greedily from each occurrence of its first
+// rune and keeps the best result
+func fuzzyScore(query, candidate string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	c := []rune(strings.ToLower(candidate))
+	if len(q) == 0 {
+		return -len(c) / 8, true
+	}
+	base := utf8.RuneCountInString(candidate[:strings.LastIndex(strings.TrimSuffix(candidate, "/"), "/")+1])
+
+	best, found := 0, false
+	for start, r := range c {
+		if r != q[0] {
+			continue
+		}
+		if s, ok := matchFrom(q, c, start, base); ok && (!found || s > best) {
+			best, found = s, true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	if strings.Contains(string(c), string(q)) {
+		best += 10
+	}
+	return best - len(c)/8, true
+}
+
+func matchFrom(q, c []rune, start, base int) (int, bool) {
+	score, qi, prev := 0, 0, -2
+	for ci := start; ci < len(c) && qi < len(q); ci++ {
+		if c[ci] != q[qi] {
+			continue
+		}
+		score++
+		if ci == prev+1 {
+			score += 5
+		} else if prev >= 0 {
+			score -= min(ci-prev-1, 4) // gaps inside the match
+		}
+		if ci == 0 || strings.ContainsRune("/_-. ", c[ci-1]) {
+			score += 3
+		}
+		if ci >= base {
+			score += 2
+		}
+		prev = ci
+		qi++
+	}
+	return score, qi == len(q)
+}
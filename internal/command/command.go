@@ -0,0 +1,180 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/logger"
+)
+
+const (
+	shellTimeout    = 30 * time.Second
+	maxIncludeBytes = 64 * 1024
+)
+
+// Command is a slash command defined by a markdown prompt template
+type Command struct {
+	Name        string
+	Description string
+	Template    string
+	Source      string
+}
+
+// All returns the custom commands from ~/.config/otter/commands/*.md, then
+// .otter/commands/*.md. A later definition replaces an earlier one with the same name.
+func All() []Command {
+	var cmds []Command
+	for _, dir := range []string{filepath.Join(config.Home(), "commands"), filepath.Join(".otter", "commands")} {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		slices.Sort(paths)
+		for _, path := range paths {
+			c, err := loadFile(path)
+			if err != nil {
+				logger.Warn("skip command file", "path", path, "err", err)
+				continue
+			}
+			if i := slices.IndexFunc(cmds, func(x Command) bool { return x.Name == c.Name }); i >= 0 {
+				cmds[i] = c
+				continue
+			}
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+// Find looks a command up by name, with or without the leading "/"
+func Find(name string) (Command, bool) {
+	name = strings.TrimPrefix(name, "/")
+	for _, c := range All() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// loadFile parses a command file: optional "---" frontmatter with a
+// description, then the template. Without one the first line describes it.
+func loadFile(path string) (Command, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Command{}, err
+	}
+	c := Command{Name: strings.TrimSuffix(filepath.Base(path), ".md"), Source: path}
+	if strings.ContainsAny(c.Name, " \t") {
+		return Command{}, fmt.Errorf("command name %q contains spaces", c.Name)
+	}
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		if head, body, ok := strings.Cut(rest, "\n---"); ok {
+			for _, line := range strings.Split(head, "\n") {
+				if value, ok := strings.CutPrefix(strings.TrimSpace(line), "description:"); ok {
+					c.Description = strings.Trim(strings.TrimSpace(value), `"'`)
+				}
+			}
+			_, text, _ = strings.Cut(body, "\n")
+		}
+	}
+
+	c.Template = strings.TrimSpace(text)
+	if c.Template == "" {
+		return Command{}, fmt.Errorf("empty template")
+	}
+	if c.Description == "" {
+		first, _, _ := strings.Cut(c.Template, "\n")
+		c.Description = strings.TrimSpace(strings.TrimLeft(first, "# "))
+	}
+	return c, nil
+}
+
+var (
+	argRe = regexp.MustCompile(`\$(ARGUMENTS|ARGS|[1-9])`)
+	// !`cmd`, or @path at the start of a word
+	inlineRe = regexp.MustCompile("!`([^`]+)`|(^|\\s)@(\\S+)")
+)
+
+// Expand fills in the template: $ARGS (or $ARGUMENTS) is the whole argument
+// string and $1..$9 the individual words; a line starting with "!" or an
+// inline !`cmd` is replaced by the command's output; @path is replaced by
+// the file's contents. Arguments are appended when the template uses none.
+func (c Command) Expand(ctx context.Context, args string) string {
+	args = strings.TrimSpace(args)
+	fields := strings.Fields(args)
+	usesArgs := false
+	out := argRe.ReplaceAllStringFunc(c.Template, func(m string) string {
+		usesArgs = true
+		switch name := m[1:]; name {
+		case "ARGUMENTS", "ARGS":
+			return args
+		default:
+			n, _ := strconv.Atoi(name)
+			if n <= len(fields) {
+				return fields[n-1]
+			}
+			return ""
+		}
+	})
+	if !usesArgs && args != "" {
+		out += "\n\n" + args
+	}
+
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if cmd, ok := strings.CutPrefix(strings.TrimSpace(line), "!"); ok && !strings.HasPrefix(cmd, "`") && strings.TrimSpace(cmd) != "" {
+			lines[i] = fmt.Sprintf("$ %s\n```\n%s\n```", strings.TrimSpace(cmd), runShell(ctx, cmd))
+			continue
+		}
+		lines[i] = inlineRe.ReplaceAllStringFunc(line, func(m string) string {
+			sub := inlineRe.FindStringSubmatch(m)
+			if sub[1] != "" {
+				return runShell(ctx, sub[1])
+			}
+			return sub[2] + includeFile(sub[3])
+		})
+	}
+	return strings.Join(lines, "\n")
+}
+
+func runShell(ctx context.Context, cmd string) string {
+	ctx, cancel := context.WithTimeout(ctx, shellTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "sh", "-c", cmd).CombinedOutput()
+	result := strings.TrimRight(string(out), "\n")
+	if err != nil {
+		result += "\nerror: " + err.Error()
+	}
+	return result
+}
+
+// includeFile returns the contents of path in a fenced block. Anything that
+// isn't a readable file, like an email address, is left as written.
+func includeFile(word string) string {
+	path := strings.TrimRight(word, ".,;:)")
+	trailing := word[len(path):]
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "@" + word
+	}
+	if !config.C.CheckReadPermission(path) {
+		return "@" + path + " [permission denied]" + trailing
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "@" + word
+	}
+	if len(data) > maxIncludeBytes {
+		data = append(data[:maxIncludeBytes], "\n[truncated]"...)
+	}
+	return fmt.Sprintf("%s\n```\n%s\n```\n%s", path, strings.TrimRight(string(data), "\n"), trailing)
+}
@@ -9,18 +9,47 @@ import (
 )
 
 type ModelConfig struct {
-	Name    string `toml:"name"`
-	Alias   string `toml:"alias,omitempty"`
-	Default bool   `toml:"default,omitempty"`
+	Name          string      `toml:"name"`
+	Alias         string      `toml:"alias,omitempty"`
+	Default       bool        `toml:"default,omitempty"`
+	ContextWindow int         `toml:"context_window,omitempty"`
+	Vision        bool        `toml:"vision,omitempty"` // accepts image input
+	Params        ModelParams `toml:"params,omitempty"`
+}
+
+// ModelParams are request settings sent with every call to a model. Unset
+// fields keep the API default.
+type ModelParams struct {
+	Temperature     *float64       `toml:"temperature,omitempty"`
+	TopP            *float64       `toml:"top_p,omitempty"`
+	MaxTokens       int            `toml:"max_tokens,omitempty"`
+	Stop            []string       `toml:"stop,omitempty"`
+	ReasoningEffort string         `toml:"reasoning_effort,omitempty"` // low, medium or high; a thinking budget on Anthropic
+	ExtraBody       map[string]any `toml:"extra_body,omitempty"`       // merged into the request JSON as is
+}
+
+const defaultContextWindow = 128000
+
+// ContextTokens returns the model's context window, falling back to a common default
+func (m *ModelConfig) ContextTokens() int {
+	if m == nil || m.ContextWindow <= 0 {
+		return defaultContextWindow
+	}
+	return m.ContextWindow
 }
 
 type ProviderConfig struct {
 	Name    string            `toml:"name"`
+	Type    string            `toml:"type,omitempty"` // anthropic, openai or openai-responses; defaults to the name
 	BaseURL string            `toml:"base_url"`
 	APIKey  string            `toml:"api_key"`
 	Headers map[string]string `toml:"headers,omitempty"`
 	Models  []ModelConfig     `toml:"models"`
 	Default bool              `toml:"default,omitempty"`
+	Replay  string            `toml:"replay,omitempty"` // fixture directory: answer from recorded calls instead of the API
+	Record  bool              `toml:"record,omitempty"` // with replay, call the API and save every call there
+	// SmallModel names one of Models for auxiliary calls while this provider is current
+	SmallModel string `toml:"small_model,omitempty"`
 }
 
 type FilePermission struct {
@@ -36,11 +65,60 @@ type SecurityConfig struct {
 	File               FilePermission `toml:"file"`
 }
 
+// LSPConfig describes a language server started over stdio for files matching Match
+type LSPConfig struct {
+	Name    string   `toml:"name"`
+	Command []string `toml:"command"`
+	Match   []string `toml:"match"`
+}
+
+// DiagnosticsConfig controls the checks run on files after each write.
+// Checks: gofmt, govet, lsp
+type DiagnosticsConfig struct {
+	Enabled bool     `toml:"enabled"`
+	Checks  []string `toml:"checks"`
+	Timeout int      `toml:"timeout"` // seconds
+}
+
+// ModeConfig defines an agent mode inline in config.toml. Modes can also be
+// markdown files with the same keys as frontmatter, see package mode.
+type ModeConfig struct {
+	Name        string      `toml:"name"`
+	Description string      `toml:"description,omitempty"`
+	Model       string      `toml:"model,omitempty"` // provider/model or alias
+	Tools       []string    `toml:"tools,omitempty"`
+	MaxSteps    int         `toml:"max_steps,omitempty"`
+	Temperature *float64    `toml:"temperature,omitempty"`
+	Params      ModelParams `toml:"params,omitempty"` // over the model's params
+	Prompt      string      `toml:"prompt"`
+}
+
+// RepoMapConfig controls the outline of important files and symbols added to the system prompt
+type RepoMapConfig struct {
+	Enabled bool `toml:"enabled"`
+	Tokens  int  `toml:"tokens"`
+}
+
+// HookConfig runs Command on an agent event. For tool events Match is a
+// regexp on the tool name; empty matches every tool.
+type HookConfig struct {
+	Event   string `toml:"event"` // pre_tool, post_tool, user_prompt_submit, turn_done, session_start
+	Match   string `toml:"match,omitempty"`
+	Command string `toml:"command"`
+	Timeout int    `toml:"timeout,omitempty"` // seconds, default 30
+}
+
 type Config struct {
-	Providers []ProviderConfig `toml:"providers"`
-	Stream    bool             `toml:"stream"`
-	MaxSteps  int              `toml:"max_steps"`
-	Security  SecurityConfig   `toml:"security"`
+	Providers   []ProviderConfig  `toml:"providers"`
+	SmallModel  string            `toml:"small_model,omitempty"` // provider/model or alias for titles, summaries and other auxiliary calls
+	Stream      bool              `toml:"stream"`
+	MaxSteps    int               `toml:"max_steps"`
+	Security    SecurityConfig    `toml:"security"`
+	LSP         []LSPConfig       `toml:"lsp,omitempty"`
+	Diagnostics DiagnosticsConfig `toml:"diagnostics"`
+	RepoMap     RepoMapConfig     `toml:"repo_map"`
+	Modes       []ModeConfig      `toml:"modes,omitempty"`
+	Hooks       []HookConfig      `toml:"hooks,omitempty"`
 
 	// 当前选中的 provider 和 model（运行时）
 	currentProviderIdx int
@@ -53,6 +131,15 @@ func Load() error {
 	C = Config{
 		Stream:   false,
 		MaxSteps: 100,
+		Diagnostics: DiagnosticsConfig{
+			Enabled: true,
+			Checks:  []string{"gofmt"},
+			Timeout: 10,
+		},
+		RepoMap: RepoMapConfig{
+			Enabled: true,
+			Tokens:  2048,
+		},
 	}
 
 	home := Home()
@@ -127,6 +214,36 @@ func (c *Config) CurrentProviderName() string {
 	return p.Name
 }
 
+// SmallModelRef returns the model for auxiliary calls: the current
+// provider's small model, then the global one. "" means the main model.
+func (c *Config) SmallModelRef() string {
+	if p := c.CurrentProvider(); p != nil && p.SmallModel != "" {
+		return p.Name + "/" + p.SmallModel
+	}
+	return c.SmallModel
+}
+
+// FindModel resolves "provider/model" or a bare model name or alias
+func (c *Config) FindModel(ref string) (*ProviderConfig, *ModelConfig) {
+	providerName, modelName, qualified := strings.Cut(ref, "/")
+	if !qualified {
+		providerName, modelName = "", ref
+	}
+	for i := range c.Providers {
+		p := &c.Providers[i]
+		if qualified && p.Name != providerName {
+			continue
+		}
+		for j := range p.Models {
+			m := &p.Models[j]
+			if m.Name == modelName || m.Alias == modelName {
+				return p, m
+			}
+		}
+	}
+	return nil, nil
+}
+
 func (c *Config) SetModel(providerName, modelName string) bool {
 	for i := range c.Providers {
 		p := &c.Providers[i]
@@ -191,6 +308,11 @@ func SessionsDir() string {
 	return filepath.Join(Home(), "sessions", WorkDirName())
 }
 
+// SpillDir holds full tool outputs that were truncated before reaching the model
+func SpillDir() string {
+	return filepath.Join(Home(), "spill", WorkDirName())
+}
+
 func WorkDirName() string {
 	wd, _ := os.Getwd()
 	if wd == "" {
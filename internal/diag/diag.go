@@ -0,0 +1,294 @@
+package diag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/diff"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/lsp"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const maxReported = 20
+
+// Diagnostic is one problem reported by a check
+type Diagnostic struct {
+	Path    string
+	Line    int // 1-based
+	Col     int
+	Source  string
+	Message string
+}
+
+func (d Diagnostic) key() string { return d.Source + "\x00" + d.Message }
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: [%s] %s", types.DisplayPath(d.Path), d.Line, d.Col, d.Source, d.Message)
+}
+
+// Runner checks files after they are written and reports only the
+// diagnostics that the write introduced
+type Runner struct {
+	cfg config.DiagnosticsConfig
+
+	mu   sync.Mutex
+	seen map[string]map[string]bool // path -> diagnostic keys from the last check
+}
+
+func NewRunner(cfg config.DiagnosticsConfig) *Runner {
+	return &Runner{cfg: cfg, seen: make(map[string]map[string]bool)}
+}
+
+// Check runs the configured checks on the changed files. It returns a short
+// report of new diagnostics, or "" when there are none.
+func (r *Runner) Check(ctx context.Context, files []diff.File) string {
+	if r == nil || !r.cfg.Enabled || len(files) == 0 {
+		return ""
+	}
+	timeout := time.Duration(max(r.cfg.Timeout, 1)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var paths []string
+	changed := make(map[string]map[int]bool)
+	for _, f := range files {
+		abs, err := filepath.Abs(f.Path)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(abs); err != nil {
+			continue // deleted
+		}
+		paths = append(paths, abs)
+		changed[abs] = changedLines(f)
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+
+	found := make(map[string][]Diagnostic)
+	for _, check := range r.cfg.Checks {
+		var ds []Diagnostic
+		var err error
+		switch check {
+		case "gofmt":
+			ds, err = gofmt(ctx, paths)
+		case "govet":
+			ds, err = govet(ctx, paths)
+		case "lsp":
+			ds, err = lspCheck(ctx, paths)
+		default:
+			err = fmt.Errorf("unknown check %q", check)
+		}
+		if err != nil {
+			logger.Warn("diagnostics check failed", "check", check, "err", err)
+		}
+		for _, d := range ds {
+			found[d.Path] = append(found[d.Path], d)
+		}
+	}
+
+	var fresh []Diagnostic
+	r.mu.Lock()
+	for _, path := range paths {
+		prev, checked := r.seen[path]
+		cur := make(map[string]bool)
+		for _, d := range found[path] {
+			cur[d.key()] = true
+			// Without an earlier check to compare against, only blame the
+			// write for problems on the lines it touched
+			if checked && !prev[d.key()] || !checked && changed[path][d.Line] {
+				fresh = append(fresh, d)
+			}
+		}
+		r.seen[path] = cur
+	}
+	r.mu.Unlock()
+
+	return report(fresh)
+}
+
+func report(ds []Diagnostic) string {
+	if len(ds) == 0 {
+		return ""
+	}
+	slices.SortStableFunc(ds, func(a, b Diagnostic) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return strings.Compare(a.Message, b.Message)
+	})
+	// gofmt and go vet both report syntax errors
+	ds = slices.CompactFunc(ds, func(a, b Diagnostic) bool {
+		return a.Path == b.Path && a.Line == b.Line && a.Message == b.Message
+	})
+
+	var sb strings.Builder
+	noun := "diagnostic"
+	if len(ds) > 1 {
+		noun += "s"
+	}
+	fmt.Fprintf(&sb, "⚠ %d new %s introduced at %s:%d\n", len(ds), noun, types.DisplayPath(ds[0].Path), ds[0].Line)
+	for i, d := range ds {
+		if i == maxReported {
+			fmt.Fprintf(&sb, "... and %d more\n", len(ds)-maxReported)
+			break
+		}
+		sb.WriteString(d.String())
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// changedLines returns the new-side line numbers touched by f, including the
+// line where a deletion happened
+func changedLines(f diff.File) map[int]bool {
+	lines := make(map[int]bool)
+	for _, h := range f.Hunks {
+		n := h.NewStart
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case diff.Equal:
+				n++
+			case diff.Insert:
+				lines[n] = true
+				n++
+			case diff.Delete:
+				lines[n] = true
+			}
+		}
+	}
+	return lines
+}
+
+// file:line:col: message, as printed by gofmt and go vet
+var posLine = regexp.MustCompile(`^(?:vet: )?(.+?\.go):(\d+):(?:(\d+):)? (.+)$`)
+
+func parsePositions(out []byte, dir, source string) []Diagnostic {
+	var ds []Diagnostic
+	for _, line := range strings.Split(string(out), "\n") {
+		m := posLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		path := m[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		ln, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		ds = append(ds, Diagnostic{Path: filepath.Clean(path), Line: ln, Col: col, Source: source, Message: m[4]})
+	}
+	return ds
+}
+
+func goFiles(paths []string) []string {
+	var out []string
+	for _, p := range paths {
+		if strings.HasSuffix(p, ".go") {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// gofmt reports syntax errors
+func gofmt(ctx context.Context, paths []string) ([]Diagnostic, error) {
+	files := goFiles(paths)
+	if len(files) == 0 {
+		return nil, nil
+	}
+	cmd := exec.CommandContext(ctx, "gofmt", append([]string{"-e", "-l"}, files...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil && stderr.Len() == 0 {
+		return nil, err
+	}
+	return parsePositions(stderr.Bytes(), "", "gofmt"), nil
+}
+
+// govet runs go vet once per package directory and keeps results for the touched files
+func govet(ctx context.Context, paths []string) ([]Diagnostic, error) {
+	files := goFiles(paths)
+	if len(files) == 0 {
+		return nil, nil
+	}
+	touched := make(map[string]bool)
+	var dirs []string
+	for _, f := range files {
+		touched[f] = true
+		if d := filepath.Dir(f); !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+
+	var ds []Diagnostic
+	for _, dir := range dirs {
+		cmd := exec.CommandContext(ctx, "go", "vet", ".")
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return ds, ctx.Err()
+		}
+		if err != nil && len(out) == 0 {
+			return ds, err
+		}
+		for _, d := range parsePositions(out, dir, "govet") {
+			if touched[d.Path] {
+				ds = append(ds, d)
+			}
+		}
+	}
+	return ds, nil
+}
+
+// lspCheck asks the configured language server for errors and warnings
+func lspCheck(ctx context.Context, paths []string) ([]Diagnostic, error) {
+	m := lsp.Shared()
+	var ds []Diagnostic
+	for _, path := range paths {
+		if !m.Configured(path) {
+			continue
+		}
+		c, err := m.For(ctx, path)
+		if err != nil {
+			return ds, err
+		}
+		diags, err := c.Diagnostics(ctx, path)
+		if err != nil {
+			return ds, err
+		}
+		for _, d := range diags {
+			if d.Severity > lsp.SeverityWarning {
+				continue
+			}
+			source := c.Name()
+			if d.Source != "" {
+				source = d.Source
+			}
+			ds = append(ds, Diagnostic{
+				Path:    path,
+				Line:    d.Range.Start.Line + 1,
+				Col:     d.Range.Start.Character + 1,
+				Source:  source,
+				Message: d.Message,
+			})
+		}
+	}
+	return ds, nil
+}
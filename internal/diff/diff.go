@@ -0,0 +1,247 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const contextLines = 3
+
+// Kind marks a diff line as context, addition or removal
+type Kind byte
+
+const (
+	Equal  Kind = ' '
+	Insert Kind = '+'
+	Delete Kind = '-'
+)
+
+type Line struct {
+	Kind Kind   `json:"kind"`
+	Text string `json:"text"`
+}
+
+// Hunk is a contiguous block of changes with surrounding context. Starts are 1-based.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// File is the line diff of one file
+type File struct {
+	Path    string `json:"path"`
+	Hunks   []Hunk `json:"hunks"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// Compute returns the diff between two versions of a file
+func Compute(path, old, new string) File {
+	lines := Lines(SplitLines(old), SplitLines(new))
+	f := File{Path: path, Hunks: hunks(lines)}
+	for _, l := range lines {
+		switch l.Kind {
+		case Insert:
+			f.Added++
+		case Delete:
+			f.Removed++
+		}
+	}
+	return f
+}
+
+// Empty reports whether the two versions were identical
+func (f File) Empty() bool { return len(f.Hunks) == 0 }
+
+// Unified renders f in unified diff format
+func (f File) Unified() string {
+	if f.Empty() {
+		return ""
+	}
+	var b strings.Builder
+	if strings.HasPrefix(f.Path, "/") {
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", f.Path, f.Path)
+	} else {
+		fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", f.Path, f.Path)
+	}
+	for _, h := range f.Hunks {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		for _, l := range h.Lines {
+			b.WriteByte(byte(l.Kind))
+			b.WriteString(l.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// Unified renders several file diffs one after another
+func Unified(files []File) string {
+	var b strings.Builder
+	for _, f := range files {
+		b.WriteString(f.Unified())
+	}
+	return b.String()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		start--
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// SplitLines splits s into lines without their trailing newline
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines returns the shortest edit script turning a into b (Myers' algorithm)
+func Lines(a, b []string) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var out []Line
+	for _, s := range a[:prefix] {
+		out = append(out, Line{Equal, s})
+	}
+	out = append(out, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, s := range a[len(a)-suffix:] {
+		out = append(out, Line{Equal, s})
+	}
+	return out
+}
+
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= offset; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var rev []Line
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, Line{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, Line{Insert, b[y-1]})
+			} else {
+				rev = append(rev, Line{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	out := make([]Line, len(rev))
+	for i, l := range rev {
+		out[len(rev)-1-i] = l
+	}
+	return out
+}
+
+// hunks groups an edit script into hunks with surrounding context
+func hunks(lines []Line) []Hunk {
+	var out []Hunk
+	oldNo, newNo := make([]int, len(lines)), make([]int, len(lines))
+	o, n := 1, 1
+	for i, l := range lines {
+		oldNo[i], newNo[i] = o, n
+		if l.Kind != Insert {
+			o++
+		}
+		if l.Kind != Delete {
+			n++
+		}
+	}
+
+	i := 0
+	for i < len(lines) {
+		if lines[i].Kind == Equal {
+			i++
+			continue
+		}
+		start := max(i-contextLines, 0)
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].Kind != Equal {
+				end = j
+				continue
+			}
+			if j-end > 2*contextLines {
+				break
+			}
+		}
+		stop := min(end+contextLines+1, len(lines))
+
+		h := Hunk{OldStart: oldNo[start], NewStart: newNo[start], Lines: lines[start:stop]}
+		for _, l := range h.Lines {
+			if l.Kind != Insert {
+				h.OldLines++
+			}
+			if l.Kind != Delete {
+				h.NewLines++
+			}
+		}
+		out = append(out, h)
+		i = stop
+	}
+	return out
+}
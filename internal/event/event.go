@@ -1,6 +1,11 @@
 package event
 
-import "github.com/abcdlsj/otter/internal/types"
+import (
+	"encoding/json"
+
+	"github.com/abcdlsj/otter/internal/diff"
+	"github.com/abcdlsj/otter/internal/types"
+)
 
 type Type string
 
@@ -8,58 +13,89 @@ const (
 	TextDelta    Type = "text_delta"
 	ToolStart    Type = "tool_start"
 	ToolEnd      Type = "tool_end"
+	UserMessage  Type = "user_message" // a queued message added to a running turn
+	Step         Type = "step"         // a message of the turn, sent as soon as it's complete
+	Usage        Type = "usage"        // tokens used by one model call
 	CompactStart Type = "compact_start"
 	CompactEnd   Type = "compact_end"
+	Paused       Type = "paused" // the turn stopped so the user can decide whether it goes on
 	Done         Type = "done"
 	Error        Type = "error"
 )
 
 type Event struct {
-	Type Type
-	Data any
+	Type   Type   `json:"type"`
+	Data   any    `json:"data,omitempty"`
+	Parent string `json:"parent,omitempty"` // ID of the task tool call that produced a sub-agent event
 }
 
 type TextDeltaData struct {
-	Text string
+	Text string `json:"text"`
+}
+
+type UserMessageData struct {
+	Text string `json:"text"`
 }
 
 type ToolStartData struct {
-	ID   string
-	Name string
-	Args string
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Args string `json:"args"`
 }
 
 type ToolEndData struct {
-	ID     string
-	Name   string
-	Result string
-	Error  string
+	ID     string      `json:"id"`
+	Name   string      `json:"name"`
+	Result string      `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Diffs  []diff.File `json:"diffs,omitempty"` // files changed by write-type tools
+}
+
+type StepData struct {
+	Message Message `json:"message"`
 }
 
+// DoneData totals the usage of every call in the turn, including
+// compaction and sub-agents
 type DoneData struct {
-	FullText     string
-	InputTokens  int64
-	OutputTokens int64
-	Messages     []Message
+	FullText     string    `json:"full_text"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+	Messages     []Message `json:"messages,omitempty"`
+}
+
+type UsageData struct {
+	Usage types.Usage `json:"usage"`
+	Step  int         `json:"step"` // 1-based step of the turn; 0 for calls outside the loop
 }
 
 type Message struct {
-	Role        string
-	Content     string
-	ToolCalls   []types.ToolCall
-	ToolResults []types.ToolResult
+	Role        string             `json:"role"`
+	Content     string             `json:"content,omitempty"`
+	ToolCalls   []types.ToolCall   `json:"tool_calls,omitempty"`
+	ToolResults []types.ToolResult `json:"tool_results,omitempty"`
+	Usage       []types.Usage      `json:"usage,omitempty"` // the call that wrote an assistant message; sub-agents for tool results
+	// Opaque reasoning items (openai-responses) to send back on later turns
+	ReasoningItems []json.RawMessage `json:"reasoning_items,omitempty"`
 }
 
 type CompactStartData struct {
-	Tokens    int64
-	Threshold int64
+	Tokens    int64 `json:"tokens"`
+	Threshold int64 `json:"threshold"`
 }
 
 type CompactEndData struct {
-	Before int64
-	After  int64
+	Before int64        `json:"before"`
+	After  int64        `json:"after"`
+	Usage  *types.Usage `json:"usage,omitempty"` // the summarizing call
+}
+
+// PausedData ends a turn that ran out of steps or kept repeating itself
+type PausedData struct {
+	Reason string `json:"reason"`
+	Steps  int    `json:"steps"` // steps taken in this run
 }
 
 type ErrorData struct {
-	Message string
+	Message string `json:"message"`
 }
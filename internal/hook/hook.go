@@ -0,0 +1,193 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/event"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+type Event string
+
+const (
+	PreTool          Event = "pre_tool"
+	PostTool         Event = "post_tool"
+	UserPromptSubmit Event = "user_prompt_submit"
+	TurnDone         Event = "turn_done"
+	SessionStart     Event = "session_start"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	maxOutputRunes = 16 * 1024
+)
+
+// Payload is written to the hook's stdin as JSON
+type Payload struct {
+	Event  Event                `json:"event"`
+	Cwd    string               `json:"cwd"`
+	Tool   *event.ToolStartData `json:"tool,omitempty"`   // pre_tool, post_tool
+	Result *event.ToolEndData   `json:"result,omitempty"` // post_tool
+	Prompt string               `json:"prompt,omitempty"` // user_prompt_submit, session_start
+	Done   *event.DoneData      `json:"done,omitempty"`   // turn_done
+}
+
+// Result combines the hooks that ran for one event
+type Result struct {
+	Blocked bool
+	Reason  string // why a hook blocked, from its stderr or stdout
+	Output  string // stdout of the hooks that succeeded
+}
+
+type hook struct {
+	config.HookConfig
+	match *regexp.Regexp
+}
+
+// Runner runs the configured hooks
+type Runner struct {
+	hooks []hook
+}
+
+// NewRunner compiles the hook configs, skipping ones with an invalid match
+func NewRunner(cfgs []config.HookConfig) *Runner {
+	r := &Runner{}
+	for _, c := range cfgs {
+		if c.Command == "" {
+			continue
+		}
+		h := hook{HookConfig: c}
+		if c.Match != "" {
+			re, err := regexp.Compile("^(?:" + c.Match + ")$")
+			if err != nil {
+				logger.Warn("skip hook with invalid match", "match", c.Match, "err", err)
+				continue
+			}
+			h.match = re
+		}
+		r.hooks = append(r.hooks, h)
+	}
+	return r
+}
+
+// Has reports whether any hook listens for ev
+func (r *Runner) Has(ev Event) bool {
+	for _, h := range r.hooks {
+		if Event(h.Event) == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the hooks for p.Event in config order. A hook that exits non-zero
+// blocks the action and stops the rest, and so does one that times out or
+// can't start, so a guard never fails open. For events that can't be
+// blocked (post_tool, turn_done, session_start) failures are only logged.
+func (r *Runner) Run(ctx context.Context, p Payload) Result {
+	var res Result
+	if r == nil || !r.Has(p.Event) {
+		return res
+	}
+	if p.Cwd == "" {
+		p.Cwd, _ = os.Getwd()
+	}
+	input, err := json.Marshal(p)
+	if err != nil {
+		logger.Warn("hook payload", "err", err)
+		return res
+	}
+
+	var outputs []string
+	for _, h := range r.hooks {
+		if Event(h.Event) != p.Event || !h.matches(p) {
+			continue
+		}
+		stdout, stderr, err := h.exec(ctx, input)
+		var exit *exec.ExitError
+		switch {
+		case err == nil:
+			if out := strings.TrimSpace(stdout); out != "" {
+				outputs = append(outputs, out)
+			}
+		case errors.As(err, &exit) && blockable(p.Event):
+			reason := strings.TrimSpace(stderr)
+			if reason == "" {
+				reason = strings.TrimSpace(stdout)
+			}
+			if reason == "" {
+				reason = fmt.Sprintf("hook %q exited with %d", h.Command, exit.ExitCode())
+			}
+			logger.Info("hook blocked", "event", p.Event, "command", h.Command, "reason", reason)
+			return Result{Blocked: true, Reason: reason}
+		case blockable(p.Event):
+			reason := fmt.Sprintf("hook %q failed (%v), so the action was blocked", h.Command, err)
+			logger.Warn("hook failed", "event", p.Event, "command", h.Command, "err", err, "stderr", strings.TrimSpace(stderr))
+			return Result{Blocked: true, Reason: reason}
+		default:
+			logger.Warn("hook failed", "event", p.Event, "command", h.Command, "err", err, "stderr", strings.TrimSpace(stderr))
+		}
+	}
+	res.Output = strings.Join(outputs, "\n")
+	return res
+}
+
+// Append adds hook output to text sent to the model, marked so the model
+// knows where it came from
+func Append(text, output string) string {
+	if output == "" {
+		return text
+	}
+	return text + "\n\n<hook-output>\n" + output + "\n</hook-output>"
+}
+
+func blockable(ev Event) bool {
+	return ev == PreTool || ev == UserPromptSubmit
+}
+
+func (h hook) matches(p Payload) bool {
+	if h.match == nil || p.Tool == nil {
+		return true
+	}
+	return h.match.MatchString(p.Tool.Name)
+}
+
+func (h hook) exec(ctx context.Context, input []byte) (string, string, error) {
+	timeout := defaultTimeout
+	if h.Timeout > 0 {
+		timeout = time.Duration(h.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "OTTER_HOOK_EVENT="+h.Event)
+	cmd.WaitDelay = time.Second // don't wait on children still holding the pipes
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	return truncate(stdout.String()), truncate(stderr.String()), err
+}
+
+func truncate(s string) string {
+	if t := types.TruncateRunes(s, maxOutputRunes); len(t) < len(s) {
+		return t + "\n[truncated]"
+	}
+	return s
+}
@@ -0,0 +1,40 @@
+package hook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/event"
+)
+
+func TestPreToolFailsClosed(t *testing.T) {
+	tests := []struct {
+		name string
+		hook config.HookConfig
+	}{
+		{"non-zero exit", config.HookConfig{Event: "pre_tool", Command: "echo denied >&2; exit 2"}},
+		{"timeout", config.HookConfig{Event: "pre_tool", Command: "sleep 5", Timeout: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := NewRunner([]config.HookConfig{tt.hook}).Run(context.Background(), Payload{
+				Event: PreTool,
+				Tool:  &event.ToolStartData{Name: "shell"},
+			})
+			if !res.Blocked || res.Reason == "" {
+				t.Errorf("result = %+v, want blocked with a reason", res)
+			}
+		})
+	}
+}
+
+func TestTruncateKeepsRunes(t *testing.T) {
+	s := strings.Repeat("é", maxOutputRunes+10)
+	got := truncate(s)
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, "[truncated]") {
+		t.Errorf("truncate split a rune or dropped the marker: %q", got[len(got)-20:])
+	}
+}
@@ -17,13 +17,16 @@ type AnthropicProvider struct {
 	model  string
 }
 
-func NewAnthropicProvider(apiKey, model, baseURL string) (*AnthropicProvider, error) {
+func NewAnthropicProvider(apiKey, model, baseURL string, headers map[string]string) (*AnthropicProvider, error) {
 	opts := []option.RequestOption{
 		option.WithAPIKey(apiKey),
 	}
 	if baseURL != "" {
 		opts = append(opts, option.WithBaseURL(baseURL))
 	}
+	for k, v := range headers {
+		opts = append(opts, option.WithHeader(k, v))
+	}
 
 	client := anthropic.NewClient(opts...)
 	return &AnthropicProvider{
@@ -45,17 +48,27 @@ func (p *AnthropicProvider) Chat(ctx context.Context, lg logger.Logger, messages
 
 		if msg.Role == "user" {
 			var blocks []anthropic.ContentBlockParamUnion
+			// 图片放在文本之前
+			for _, img := range msg.Images {
+				data, err := encodeImage(img)
+				if err != nil {
+					blocks = append(blocks, anthropic.NewTextBlock(imageNote(err)))
+					continue
+				}
+				blocks = append(blocks, anthropic.NewImageBlockBase64(img.MediaType, data))
+			}
 			// 添加文本内容
 			if msg.Content != "" {
 				blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
 			}
 			// 添加工具结果
 			for _, tr := range msg.ToolResults {
-				blocks = append(blocks, anthropic.NewToolResultBlock(tr.ToolCallID, tr.Content, false))
+				blocks = append(blocks, toolResultBlock(tr))
 			}
 			apiMessages = append(apiMessages, anthropic.NewUserMessage(blocks...))
 		} else if msg.Role == "assistant" {
-			var blocks []anthropic.ContentBlockParamUnion
+			// Thinking goes back first and unchanged, as tool use requires
+			blocks := thinkingBlocks(msg.ReasoningItems)
 			if msg.Content != "" {
 				blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
 			}
@@ -68,7 +81,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, lg logger.Logger, messages
 		} else if msg.Role == "tool" {
 			var blocks []anthropic.ContentBlockParamUnion
 			for _, tr := range msg.ToolResults {
-				blocks = append(blocks, anthropic.NewToolResultBlock(tr.ToolCallID, tr.Content, false))
+				blocks = append(blocks, toolResultBlock(tr))
 			}
 			if len(blocks) > 0 {
 				apiMessages = append(apiMessages, anthropic.NewUserMessage(blocks...))
@@ -81,6 +94,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, lg logger.Logger, messages
 		MaxTokens: 16384,
 		Messages:  apiMessages,
 	}
+	opts := applyAnthropicParams(&params, paramsFrom(ctx))
 
 	if systemContent != "" {
 		params.System = []anthropic.TextBlockParam{{
@@ -111,7 +125,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, lg logger.Logger, messages
 		lg.Debug("llm request", "model", p.model, "messages", len(messages), "tools", len(tools))
 	}
 
-	resp, err := p.client.Messages.New(ctx, params)
+	resp, err := p.client.Messages.New(ctx, params, opts...)
 	if err != nil {
 		lg.Error("llm request failed", "error", err)
 		return nil, err
@@ -126,6 +140,80 @@ func (p *AnthropicProvider) Chat(ctx context.Context, lg logger.Logger, messages
 	return parseAnthropicResponse(resp, messages), nil
 }
 
+// toolResultBlock builds a tool result, with any images after the text
+func toolResultBlock(tr types.ToolResult) anthropic.ContentBlockParamUnion {
+	block := anthropic.NewToolResultBlock(tr.ToolCallID, tr.Content, false)
+	for _, img := range tr.Images {
+		part := anthropic.ToolResultBlockParamContentUnion{}
+		if data, err := encodeImage(img); err != nil {
+			part.OfText = &anthropic.TextBlockParam{Text: imageNote(err)}
+		} else {
+			part.OfImage = anthropic.NewImageBlockBase64(img.MediaType, data).OfImage
+		}
+		block.OfToolResult.Content = append(block.OfToolResult.Content, part)
+	}
+	return block
+}
+
+// thinkingBudgets maps a reasoning effort to extended thinking tokens
+var thinkingBudgets = map[string]int64{"low": 4096, "medium": 16384, "high": 32768}
+
+// applyAnthropicParams sets the typed params on the request and returns
+// the extra body keys as request options
+func applyAnthropicParams(req *anthropic.MessageNewParams, params Params) []option.RequestOption {
+	if params.Temperature != nil {
+		req.Temperature = anthropic.Float(*params.Temperature)
+	}
+	if params.TopP != nil {
+		req.TopP = anthropic.Float(*params.TopP)
+	}
+	if params.MaxTokens > 0 {
+		req.MaxTokens = int64(params.MaxTokens)
+	}
+	req.StopSequences = params.Stop
+	if budget, ok := thinkingBudgets[params.ReasoningEffort]; ok {
+		req.Thinking = anthropic.ThinkingConfigParamOfEnabled(budget)
+		// The budget is part of max_tokens, so leave room for the answer
+		if req.MaxTokens <= budget {
+			req.MaxTokens = budget + 16384
+		}
+	}
+	var opts []option.RequestOption
+	// The SDK refuses non-streaming calls it expects to pass ten minutes
+	// unless they carry their own timeout
+	if req.MaxTokens > 16384 {
+		opts = append(opts, option.WithRequestTimeout(time.Duration(req.MaxTokens)*time.Hour/128000+time.Minute))
+	}
+	for k, v := range params.ExtraBody {
+		opts = append(opts, option.WithJSONSet(k, v))
+	}
+	return opts
+}
+
+// thinkingBlocks rebuilds the thinking blocks of an earlier response.
+// Items from other providers are skipped.
+func thinkingBlocks(items []json.RawMessage) []anthropic.ContentBlockParamUnion {
+	var blocks []anthropic.ContentBlockParamUnion
+	for _, raw := range items {
+		var b struct {
+			Type      string `json:"type"`
+			Thinking  string `json:"thinking"`
+			Signature string `json:"signature"`
+			Data      string `json:"data"`
+		}
+		if json.Unmarshal(raw, &b) != nil {
+			continue
+		}
+		switch b.Type {
+		case "thinking":
+			blocks = append(blocks, anthropic.NewThinkingBlock(b.Signature, b.Thinking))
+		case "redacted_thinking":
+			blocks = append(blocks, anthropic.NewRedactedThinkingBlock(b.Data))
+		}
+	}
+	return blocks
+}
+
 func (p *AnthropicProvider) ChatStream(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (<-chan StreamChunk, <-chan *Response) {
 	chunkCh := make(chan StreamChunk, 16)
 	respCh := make(chan *Response, 1)
@@ -151,13 +239,19 @@ func (p *AnthropicProvider) ChatStream(ctx context.Context, lg logger.Logger, me
 }
 
 func parseAnthropicResponse(resp *anthropic.Message, messages []Message) *Response {
-	var content string
+	var content, thinking string
+	var items []json.RawMessage
 	var toolCalls []types.ToolCall
 
 	for _, block := range resp.Content {
 		switch b := block.AsAny().(type) {
 		case anthropic.TextBlock:
 			content += b.Text
+		case anthropic.ThinkingBlock:
+			thinking += b.Thinking
+			items = append(items, json.RawMessage(b.RawJSON()))
+		case anthropic.RedactedThinkingBlock:
+			items = append(items, json.RawMessage(b.RawJSON()))
 		case anthropic.ToolUseBlock:
 			argsJSON, _ := json.Marshal(b.Input)
 			toolCalls = append(toolCalls, types.ToolCall{
@@ -169,9 +263,11 @@ func parseAnthropicResponse(resp *anthropic.Message, messages []Message) *Respon
 	}
 
 	response := &Response{
-		Content:    content,
-		ToolCalls:  toolCalls,
-		StopReason: string(resp.StopReason),
+		Content:          content,
+		ReasoningContent: thinking,
+		ReasoningItems:   items,
+		ToolCalls:        toolCalls,
+		StopReason:       string(resp.StopReason),
 	}
 	if resp.Usage.InputTokens > 0 {
 		response.InputTokens = int64(resp.Usage.InputTokens)
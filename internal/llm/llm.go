@@ -1,8 +1,13 @@
 package llm
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"maps"
 
 	"github.com/abcdlsj/otter/internal/config"
 	"github.com/abcdlsj/otter/internal/logger"
@@ -14,6 +19,8 @@ type Message struct {
 	Role             string
 	Content          string
 	ReasoningContent string
+	ReasoningItems   []json.RawMessage // opaque reasoning sent back to the Responses API
+	Images           []types.Image
 	ToolCalls        []types.ToolCall
 	ToolResults      []types.ToolResult
 }
@@ -27,6 +34,7 @@ type Tool struct {
 type Response struct {
 	Content          string
 	ReasoningContent string
+	ReasoningItems   []json.RawMessage
 	ToolCalls        []types.ToolCall
 	StopReason       string
 	InputTokens      int64
@@ -43,8 +51,44 @@ type Provider interface {
 	ChatStream(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (<-chan StreamChunk, <-chan *Response)
 }
 
+// Params are per-request settings: the model's [params] table, with a
+// mode's on top. Unset fields keep the provider default.
+type Params config.ModelParams
+
+// merge returns p with the fields set in o replacing its own. Extra body
+// keys are merged one by one.
+func (p Params) merge(o Params) Params {
+	if o.Temperature != nil {
+		p.Temperature = o.Temperature
+	}
+	if o.TopP != nil {
+		p.TopP = o.TopP
+	}
+	if o.MaxTokens > 0 {
+		p.MaxTokens = o.MaxTokens
+	}
+	if o.Stop != nil {
+		p.Stop = o.Stop
+	}
+	if o.ReasoningEffort != "" {
+		p.ReasoningEffort = o.ReasoningEffort
+	}
+	if len(o.ExtraBody) > 0 {
+		extra := maps.Clone(p.ExtraBody)
+		if extra == nil {
+			extra = make(map[string]any, len(o.ExtraBody))
+		}
+		maps.Copy(extra, o.ExtraBody)
+		p.ExtraBody = extra
+	}
+	return p
+}
+
 type LLM struct {
 	provider Provider
+	params   Params
+	vision   bool
+	model    string // provider/model, for usage reports
 }
 
 func New() (*LLM, error) {
@@ -52,7 +96,51 @@ func New() (*LLM, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &LLM{provider: provider}, nil
+	m := config.C.CurrentModel()
+	return &LLM{
+		provider: provider,
+		params:   Params(m.Params),
+		vision:   m.Vision,
+		model:    config.C.CurrentProviderName() + "/" + m.Name,
+	}, nil
+}
+
+// NewFor creates a client for a specific model, given as "provider/model" or an alias
+func NewFor(ref string) (*LLM, error) {
+	p, m := config.C.FindModel(ref)
+	if p == nil {
+		return nil, fmt.Errorf("model %q not found", ref)
+	}
+	provider, err := createProvider(p, m)
+	if err != nil {
+		return nil, err
+	}
+	return &LLM{provider: provider, params: Params(m.Params), vision: m.Vision, model: p.Name + "/" + m.Name}, nil
+}
+
+// NewWithProvider wraps a provider built outside the config, such as a
+// scripted or replaying one in tests. model names it in usage reports.
+func NewWithProvider(p Provider, model string, vision bool) *LLM {
+	return &LLM{provider: p, vision: vision, model: model}
+}
+
+// Vision reports whether the model accepts images
+func (l *LLM) Vision() bool { return l.vision }
+
+// Model returns the provider/model the client talks to
+func (l *LLM) Model() string { return l.model }
+
+// Usage returns the token usage of resp as a call of the given kind
+func (l *LLM) Usage(kind string, resp *Response) types.Usage {
+	return types.Usage{Kind: kind, Model: l.model, Input: resp.InputTokens, Output: resp.OutputTokens}
+}
+
+// WithParams returns a copy of l whose requests use params over the
+// model's own
+func (l *LLM) WithParams(params Params) *LLM {
+	c := *l
+	c.params = l.params.merge(params)
+	return &c
 }
 
 func CreateProviderFromConfig() (Provider, error) {
@@ -65,23 +153,127 @@ func CreateProviderFromConfig() (Provider, error) {
 	if m == nil {
 		return nil, fmt.Errorf("no model configured")
 	}
+	return createProvider(p, m)
+}
+
+// createProvider builds the provider for a model. Providers with a replay
+// directory record to it, or with record unset answer only from it.
+func createProvider(p *config.ProviderConfig, m *config.ModelConfig) (Provider, error) {
+	if p.Replay != "" && !p.Record {
+		return NewReplayProvider(p.Replay, nil), nil
+	}
+	provider, err := baseProvider(p, m)
+	if err != nil || p.Replay == "" {
+		return provider, err
+	}
+	return NewReplayProvider(p.Replay, provider), nil
+}
 
-	switch p.Name {
+// baseProvider picks the API by the provider's type, or its name when no
+// type is set
+func baseProvider(p *config.ProviderConfig, m *config.ModelConfig) (Provider, error) {
+	switch kind := cmp.Or(p.Type, p.Name); kind {
 	case "anthropic", "claude":
-		return NewAnthropicProvider(p.APIKey, m.Name, p.BaseURL)
+		return NewAnthropicProvider(p.APIKey, m.Name, p.BaseURL, p.Headers)
 	case "openai":
 		return NewOpenAIProvider(p.APIKey, m.Name, p.BaseURL, p.Headers)
+	case "openai-responses":
+		return NewResponsesProvider(p.APIKey, m.Name, p.BaseURL, p.Headers)
 	default:
-		return nil, fmt.Errorf("unknown provider: %s", p.Name)
+		return nil, fmt.Errorf("unknown provider type: %s", kind)
 	}
 }
 
 func (l *LLM) Chat(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (*Response, error) {
-	return l.provider.Chat(ctx, lg, messages, tools, toolResults)
+	return l.provider.Chat(withParams(ctx, l.params), lg, l.dropImages(messages), tools, toolResults)
 }
 
 func (l *LLM) ChatStream(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (<-chan StreamChunk, <-chan *Response) {
-	return l.provider.ChatStream(ctx, lg, messages, tools, toolResults)
+	return l.provider.ChatStream(withParams(ctx, l.params), lg, l.dropImages(messages), tools, toolResults)
+}
+
+// dropImages replaces images with a note for models without vision, as
+// happens when the model is switched in a session that has images
+func (l *LLM) dropImages(messages []Message) []Message {
+	if l.vision {
+		return messages
+	}
+	var out []Message
+	for i, m := range messages {
+		has := len(m.Images) > 0
+		for _, tr := range m.ToolResults {
+			has = has || len(tr.Images) > 0
+		}
+		if !has {
+			if out != nil {
+				out = append(out, m)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]Message, 0, len(messages)), messages[:i]...)
+		}
+		if n := len(m.Images); n > 0 {
+			m.Content += fmt.Sprintf("\n\n[%d image(s) omitted: this model does not accept images]", n)
+			m.Images = nil
+		}
+		results := make([]types.ToolResult, len(m.ToolResults))
+		for j, tr := range m.ToolResults {
+			if len(tr.Images) > 0 {
+				tr.Content += "\n\n[image omitted: this model does not accept images]"
+				tr.Images = nil
+			}
+			results[j] = tr
+		}
+		m.ToolResults = results
+		out = append(out, m)
+	}
+	if out == nil {
+		return messages
+	}
+	return out
+}
+
+func encodeImage(img types.Image) (string, error) {
+	data, err := img.Bytes()
+	if err != nil {
+		return "", fmt.Errorf("image %s: %w", img.Path, err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// imageNote stands in for an image that can no longer be read, so a moved
+// or deleted file doesn't fail every later request of the session
+func imageNote(err error) string {
+	return "[" + err.Error() + "; not sent]"
+}
+
+type paramsKey struct{}
+
+// Params travel to providers through the context so the Provider interface stays unchanged
+func withParams(ctx context.Context, p Params) context.Context {
+	return context.WithValue(ctx, paramsKey{}, p)
+}
+
+func paramsFrom(ctx context.Context) Params {
+	p, _ := ctx.Value(paramsKey{}).(Params)
+	return p
+}
+
+// mergeBody sets the extra keys on a JSON request body, replacing fields
+// the provider set itself
+func mergeBody(body []byte, extra map[string]any) ([]byte, error) {
+	if len(extra) == 0 {
+		return body, nil
+	}
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("extra_body: %w", err)
+	}
+	maps.Copy(fields, extra)
+	return json.Marshal(fields)
 }
 
 func FromLangchainMessages(msgs []llms.MessageContent) []Message {
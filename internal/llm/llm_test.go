@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+func TestMissingImageBecomesNote(t *testing.T) {
+	img := types.Image{Path: filepath.Join(t.TempDir(), "gone.png"), MediaType: "image/png"}
+
+	parts := imageParts("look", []types.Image{img})
+	if len(parts) != 2 || parts[1].ImageURL != nil || !strings.Contains(parts[1].Text, "gone.png") {
+		t.Errorf("openai parts = %+v, want the text and a note", parts)
+	}
+
+	content := inputContent("look", []types.Image{img})
+	if len(content) != 2 || content[1].Type != "input_text" {
+		t.Errorf("responses content = %+v, want the text and a note", content)
+	}
+
+	block := toolResultBlock(types.ToolResult{ToolCallID: "call_1", Content: "ok", Images: []types.Image{img}})
+	blocks := block.OfToolResult.Content
+	if last := blocks[len(blocks)-1]; last.OfText == nil || !strings.Contains(last.OfText.Text, "gone.png") {
+		t.Errorf("anthropic tool result = %+v, want a note for the image", blocks)
+	}
+}
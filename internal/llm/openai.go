@@ -1,9 +1,12 @@
 package llm
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"strings"
 	"time"
@@ -18,30 +21,58 @@ type OpenAIProvider struct {
 	model  string
 }
 
-type headerRoundTripper struct {
+// requestRoundTripper sets the provider's headers and merges the extra body
+// params, which go-openai has no field for, into each request
+type requestRoundTripper struct {
 	headers map[string]string
 	base    http.RoundTripper
 }
 
-func (t *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+func (t *requestRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
 	for k, v := range t.headers {
 		req.Header.Set(k, v)
 	}
+	if extra := bodyExtras(paramsFrom(req.Context())); len(extra) > 0 && req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if body, err = mergeBody(body, extra); err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
 	return t.base.RoundTrip(req)
 }
 
+// bodyExtras returns the keys merged into a request body. go-openai omits a
+// zero temperature or top_p, so explicit zeros are sent from here.
+func bodyExtras(params Params) map[string]any {
+	extra := make(map[string]any)
+	if params.Temperature != nil && *params.Temperature == 0 {
+		extra["temperature"] = 0
+	}
+	if params.TopP != nil && *params.TopP == 0 {
+		extra["top_p"] = 0
+	}
+	maps.Copy(extra, params.ExtraBody)
+	return extra
+}
+
 func NewOpenAIProvider(apiKey, model, baseURL string, headers map[string]string) (*OpenAIProvider, error) {
 	config := openai.DefaultConfig(apiKey)
 	if baseURL != "" {
 		config.BaseURL = baseURL
 	}
-	if len(headers) > 0 {
-		config.HTTPClient = &http.Client{
-			Transport: &headerRoundTripper{
-				headers: headers,
-				base:    http.DefaultTransport,
-			},
-		}
+	config.HTTPClient = &http.Client{
+		Transport: &requestRoundTripper{
+			headers: headers,
+			base:    http.DefaultTransport,
+		},
 	}
 
 	client := openai.NewClientWithConfig(config)
@@ -52,7 +83,10 @@ func NewOpenAIProvider(apiKey, model, baseURL string, headers map[string]string)
 }
 
 func (p *OpenAIProvider) Chat(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (*Response, error) {
-	req := p.buildChatRequest(messages, tools)
+	req, err := p.buildChatRequest(paramsFrom(ctx), messages, tools)
+	if err != nil {
+		return nil, err
+	}
 
 	if debug, _ := json.MarshalIndent(req, "", "  "); debug != nil {
 		lg.WriteJSON(fmt.Sprintf("request_%s_openai.json", time.Now().Format("150405")), debug)
@@ -106,7 +140,11 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, lg logger.Logger, messa
 		defer close(chunkCh)
 		defer close(respCh)
 
-		req := p.buildChatRequest(messages, tools)
+		req, err := p.buildChatRequest(paramsFrom(ctx), messages, tools)
+		if err != nil {
+			chunkCh <- StreamChunk{Error: err}
+			return
+		}
 		stream, err := p.client.CreateChatCompletionStream(ctx, req)
 		if err != nil {
 			chunkCh <- StreamChunk{Error: err}
@@ -181,7 +219,7 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, lg logger.Logger, messa
 		if outputTokens == 0 {
 			outputTokens = EstimateOutputTokens(fullContent.String(), toolCalls, p.model)
 			if fullReasoning.Len() > 0 {
-				outputTokens += estimateTokens(fullReasoning.String(), p.model)
+				outputTokens += EstimateTokens(fullReasoning.String(), p.model)
 			}
 		}
 
@@ -197,16 +235,23 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, lg logger.Logger, messa
 	return chunkCh, respCh
 }
 
-func (p *OpenAIProvider) buildChatRequest(messages []Message, tools []Tool) openai.ChatCompletionRequest {
+func (p *OpenAIProvider) buildChatRequest(params Params, messages []Message, tools []Tool) (openai.ChatCompletionRequest, error) {
 	var msgs []openai.ChatCompletionMessage
 	for _, msg := range messages {
 		if msg.Role == "tool" && len(msg.ToolResults) > 0 {
+			var images []types.Image
 			for _, result := range msg.ToolResults {
 				msgs = append(msgs, openai.ChatCompletionMessage{
 					Role:       openai.ChatMessageRoleTool,
 					Content:    result.Content,
 					ToolCallID: result.ToolCallID,
 				})
+				images = append(images, result.Images...)
+			}
+			// Tool messages are text only, so images follow as a user message
+			if len(images) > 0 {
+				parts := imageParts("Images returned by the tool calls above:", images)
+				msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: parts})
 			}
 		} else {
 			m := openai.ChatCompletionMessage{
@@ -214,6 +259,10 @@ func (p *OpenAIProvider) buildChatRequest(messages []Message, tools []Tool) open
 				Content:          msg.Content,
 				ReasoningContent: msg.ReasoningContent,
 			}
+			if len(msg.Images) > 0 {
+				parts := imageParts(msg.Content, msg.Images)
+				m.Content, m.MultiContent = "", parts
+			}
 			for _, tc := range msg.ToolCalls {
 				m.ToolCalls = append(m.ToolCalls, openai.ToolCall{
 					ID:   tc.ID,
@@ -240,12 +289,43 @@ func (p *OpenAIProvider) buildChatRequest(messages []Message, tools []Tool) open
 		})
 	}
 
-	return openai.ChatCompletionRequest{
+	req := openai.ChatCompletionRequest{
 		Model:         p.model,
 		Messages:      msgs,
 		Tools:         openAITools,
 		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
 	}
+	if params.Temperature != nil {
+		req.Temperature = float32(*params.Temperature)
+	}
+	if params.TopP != nil {
+		req.TopP = float32(*params.TopP)
+	}
+	// max_tokens is rejected by reasoning models such as o3 and gpt-5
+	req.MaxCompletionTokens = params.MaxTokens
+	req.Stop = params.Stop
+	req.ReasoningEffort = params.ReasoningEffort
+	return req, nil
+}
+
+// imageParts builds multi-part content: the text, then each image as a data URL
+func imageParts(text string, images []types.Image) []openai.ChatMessagePart {
+	var parts []openai.ChatMessagePart
+	if text != "" {
+		parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: text})
+	}
+	for _, img := range images {
+		data, err := encodeImage(img)
+		if err != nil {
+			parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: imageNote(err)})
+			continue
+		}
+		parts = append(parts, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: "data:" + img.MediaType + ";base64," + data},
+		})
+	}
+	return parts
 }
 
 func (p *OpenAIProvider) Name() string {
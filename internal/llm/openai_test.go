@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/logger"
+)
+
+func TestOpenAIParamsForReasoningModels(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAIProvider("k", "gpt-5", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := 0.0
+	ctx := withParams(context.Background(), Params{MaxTokens: 2048, Temperature: &zero, TopP: &zero})
+	if _, err := p.Chat(ctx, logger.NewFileLogger(t.TempDir()), []Message{{Role: "user", Content: "hi"}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := body["max_tokens"]; ok {
+		t.Error("max_tokens sent, reasoning models reject it")
+	}
+	if body["max_completion_tokens"] != 2048.0 {
+		t.Errorf("max_completion_tokens = %v, want 2048", body["max_completion_tokens"])
+	}
+	for _, key := range []string{"temperature", "top_p"} {
+		if v, ok := body[key]; !ok || v != 0.0 {
+			t.Errorf("%s = %v (sent %t), want an explicit 0", key, v, ok)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+// ReplayProvider records requests and responses to fixture files, or
+// answers from them without calling a model. With an inner provider it
+// records: every call goes to inner and is saved, streamed chunks
+// included. Without one it replays, failing on requests it has no fixture
+// for.
+type ReplayProvider struct {
+	dir   string
+	inner Provider
+}
+
+func NewReplayProvider(dir string, inner Provider) *ReplayProvider {
+	return &ReplayProvider{dir: dir, inner: inner}
+}
+
+// Fixture is one recorded call, saved as <fingerprint>.json
+type Fixture struct {
+	Fingerprint string        `json:"fingerprint"`
+	Request     fingerprinted `json:"request"`
+	Response    *Response     `json:"response,omitempty"`
+	Chunks      []string      `json:"chunks,omitempty"` // streamed text, in order
+	Error       string        `json:"error,omitempty"`
+	Recorded    time.Time     `json:"recorded"`
+}
+
+// fingerprinted is the part of a request that identifies it. System
+// messages are left out as they hold the date, directory and repo map,
+// which change between runs; so are tool call IDs and descriptions.
+type fingerprinted struct {
+	Messages []fpMessage `json:"messages"`
+	Tools    []string    `json:"tools,omitempty"`
+}
+
+type fpMessage struct {
+	Role        string   `json:"role"`
+	Content     string   `json:"content,omitempty"`
+	ToolCalls   []string `json:"tool_calls,omitempty"`   // name and arguments
+	ToolResults []string `json:"tool_results,omitempty"` // content
+	Images      []string `json:"images,omitempty"`       // paths
+}
+
+func fingerprint(messages []Message, tools []Tool) (string, fingerprinted) {
+	var req fingerprinted
+	for _, m := range messages {
+		if m.Role == "system" {
+			continue
+		}
+		fm := fpMessage{Role: m.Role, Content: m.Content}
+		for _, tc := range m.ToolCalls {
+			fm.ToolCalls = append(fm.ToolCalls, tc.Name+" "+tc.Args)
+		}
+		for _, tr := range m.ToolResults {
+			fm.ToolResults = append(fm.ToolResults, tr.Content)
+		}
+		for _, img := range m.Images {
+			fm.Images = append(fm.Images, img.Path)
+		}
+		req.Messages = append(req.Messages, fm)
+	}
+	for _, t := range tools {
+		req.Tools = append(req.Tools, t.Name)
+	}
+	slices.Sort(req.Tools)
+
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), req
+}
+
+func (p *ReplayProvider) path(fp string) string {
+	return filepath.Join(p.dir, fp+".json")
+}
+
+func (p *ReplayProvider) load(messages []Message, tools []Tool) (*Fixture, error) {
+	fp, _ := fingerprint(messages, tools)
+	data, err := os.ReadFile(p.path(fp))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("replay: no fixture for request %s in %s (%d messages); record it first", fp, p.dir, len(messages))
+		}
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("replay: fixture %s: %w", p.path(fp), err)
+	}
+	return &f, nil
+}
+
+func (p *ReplayProvider) save(lg logger.Logger, f Fixture) {
+	f.Recorded = time.Now()
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(p.dir, 0755); err == nil {
+			err = os.WriteFile(p.path(f.Fingerprint), data, 0644)
+		}
+	}
+	if err != nil {
+		lg.Warn("replay: failed to save fixture", "fingerprint", f.Fingerprint, "err", err)
+		return
+	}
+	lg.Debug("replay: recorded fixture", "fingerprint", f.Fingerprint)
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (*Response, error) {
+	if p.inner == nil {
+		f, err := p.load(messages, tools)
+		if err != nil {
+			return nil, err
+		}
+		if f.Error != "" {
+			return nil, errors.New(f.Error)
+		}
+		return f.Response, nil
+	}
+
+	resp, err := p.inner.Chat(ctx, lg, messages, tools, toolResults)
+	fp, req := fingerprint(messages, tools)
+	f := Fixture{Fingerprint: fp, Request: req, Response: resp}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	p.save(lg, f)
+	return resp, err
+}
+
+func (p *ReplayProvider) ChatStream(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (<-chan StreamChunk, <-chan *Response) {
+	chunkCh := make(chan StreamChunk, 100)
+	respCh := make(chan *Response, 1)
+
+	if p.inner == nil {
+		go func() {
+			defer close(chunkCh)
+			defer close(respCh)
+			f, err := p.load(messages, tools)
+			if err == nil && f.Error != "" {
+				err = errors.New(f.Error)
+			}
+			if err != nil {
+				chunkCh <- StreamChunk{Error: err}
+				respCh <- nil
+				return
+			}
+			for _, c := range f.Chunks {
+				chunkCh <- StreamChunk{Content: c}
+			}
+			respCh <- f.Response
+		}()
+		return chunkCh, respCh
+	}
+
+	innerChunks, innerResp := p.inner.ChatStream(ctx, lg, messages, tools, toolResults)
+	go func() {
+		defer close(chunkCh)
+		defer close(respCh)
+		fp, req := fingerprint(messages, tools)
+		f := Fixture{Fingerprint: fp, Request: req}
+		for c := range innerChunks {
+			if c.Error != nil {
+				f.Error = c.Error.Error()
+			} else {
+				f.Chunks = append(f.Chunks, c.Content)
+			}
+			chunkCh <- c
+		}
+		f.Response = <-innerResp
+		p.save(lg, f)
+		respCh <- f.Response
+	}()
+	return chunkCh, respCh
+}
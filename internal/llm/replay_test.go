@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+func TestReplayRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	lg := logger.NewFileLogger(t.TempDir())
+	ctx := context.Background()
+	tools := []Tool{{Name: "view"}}
+	messages := []Message{
+		{Role: "system", Content: "recorded on monday"},
+		{Role: "user", Content: "read main.go"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call_1", Name: "view", Args: `{"path":"main.go"}`}}},
+		{Role: "tool", ToolResults: []types.ToolResult{{ToolCallID: "call_1", Content: "package main"}}},
+	}
+
+	rec := NewReplayProvider(dir, NewScriptedProvider(Reply("It is the main package.")))
+	chunks, respCh := rec.ChatStream(ctx, lg, messages, tools, nil)
+	var recorded []string
+	for c := range chunks {
+		if c.Error != nil {
+			t.Fatal(c.Error)
+		}
+		recorded = append(recorded, c.Content)
+	}
+	want := <-respCh
+
+	// The system prompt and tool call IDs change between runs
+	again := slices.Clone(messages)
+	again[0] = Message{Role: "system", Content: "replayed on tuesday"}
+	again[2].ToolCalls = []types.ToolCall{{ID: "toolu_9", Name: "view", Args: `{"path":"main.go"}`}}
+	again[3].ToolResults = []types.ToolResult{{ToolCallID: "toolu_9", Content: "package main"}}
+
+	replay := NewReplayProvider(dir, nil)
+	chunks, respCh = replay.ChatStream(ctx, lg, again, tools, nil)
+	var replayed []string
+	for c := range chunks {
+		if c.Error != nil {
+			t.Fatal(c.Error)
+		}
+		replayed = append(replayed, c.Content)
+	}
+	got := <-respCh
+	if !slices.Equal(replayed, recorded) {
+		t.Errorf("replayed chunks %q, want %q", replayed, recorded)
+	}
+	if got == nil || got.Content != want.Content || got.StopReason != want.StopReason || got.InputTokens != want.InputTokens {
+		t.Errorf("replayed response %+v, want %+v", got, want)
+	}
+
+	resp, err := replay.Chat(ctx, lg, again, tools, nil)
+	if err != nil || resp.Content != want.Content {
+		t.Errorf("Chat replay = %+v, %v", resp, err)
+	}
+
+	again[1].Content = "read go.mod"
+	if _, err := replay.Chat(ctx, lg, again, tools, nil); err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("unrecorded request: err = %v, want a missing fixture error", err)
+	}
+}
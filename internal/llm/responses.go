@@ -0,0 +1,374 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// ResponsesProvider talks to the OpenAI Responses API. Unlike Chat
+// Completions it returns reasoning as items, which are sent back on the
+// following steps of a turn so the model keeps its chain of thought
+// between tool calls.
+type ResponsesProvider struct {
+	apiKey  string
+	model   string
+	baseURL string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewResponsesProvider(apiKey, model, baseURL string, headers map[string]string) (*ResponsesProvider, error) {
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	return &ResponsesProvider{
+		apiKey:  apiKey,
+		model:   model,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		headers: headers,
+		client:  &http.Client{},
+	}, nil
+}
+
+type responsesRequest struct {
+	Model        string          `json:"model"`
+	Instructions string          `json:"instructions,omitempty"`
+	Input        []any           `json:"input"`
+	Tools        []responsesTool `json:"tools,omitempty"`
+	Stream       bool            `json:"stream,omitempty"`
+	Store        bool            `json:"store"`
+	Include      []string        `json:"include,omitempty"`
+	Reasoning    *reasoningParam `json:"reasoning,omitempty"`
+	Temperature  *float64        `json:"temperature,omitempty"`
+	TopP         *float64        `json:"top_p,omitempty"`
+	MaxTokens    int             `json:"max_output_tokens,omitempty"`
+}
+
+type reasoningParam struct {
+	Effort  string `json:"effort"`
+	Summary string `json:"summary"`
+}
+
+type responsesTool struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type responsesContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+type responsesMessage struct {
+	Type    string             `json:"type"`
+	Role    string             `json:"role"`
+	Content []responsesContent `json:"content"`
+}
+
+type responsesCall struct {
+	Type      string `json:"type"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type responsesOutput struct {
+	Type   string `json:"type"`
+	CallID string `json:"call_id"`
+	Output string `json:"output"`
+}
+
+// responsesResult is the part of a response Otter reads
+type responsesResult struct {
+	Status string            `json:"status"`
+	Output []json.RawMessage `json:"output"`
+	Usage  struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+}
+
+// outputItem is one item of a response's output
+type outputItem struct {
+	Type      string             `json:"type"`
+	Content   []responsesContent `json:"content"`
+	Summary   []responsesContent `json:"summary"`
+	CallID    string             `json:"call_id"`
+	Name      string             `json:"name"`
+	Arguments string             `json:"arguments"`
+}
+
+func (p *ResponsesProvider) buildRequest(params Params, messages []Message, tools []Tool, stream bool) (responsesRequest, error) {
+	req := responsesRequest{
+		Model:  p.model,
+		Stream: stream,
+		// Nothing is kept on OpenAI's side, so reasoning comes back encrypted
+		// for the next request
+		Store:       false,
+		Include:     []string{"reasoning.encrypted_content"},
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		MaxTokens:   params.MaxTokens,
+	}
+	// The Responses API has no stop sequences
+	if params.ReasoningEffort != "" {
+		req.Reasoning = &reasoningParam{Effort: params.ReasoningEffort, Summary: "auto"}
+	}
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if req.Instructions == "" {
+				req.Instructions = msg.Content
+				continue
+			}
+			req.Input = append(req.Input, responsesMessage{Type: "message", Role: "developer", Content: []responsesContent{{Type: "input_text", Text: msg.Content}}})
+		case "user":
+			content := inputContent(msg.Content, msg.Images)
+			req.Input = append(req.Input, responsesMessage{Type: "message", Role: "user", Content: content})
+		case "assistant":
+			for _, item := range msg.ReasoningItems {
+				// Items from other providers are skipped
+				var head struct{ Type string }
+				if json.Unmarshal(item, &head) == nil && head.Type == "reasoning" {
+					req.Input = append(req.Input, item)
+				}
+			}
+			if msg.Content != "" {
+				req.Input = append(req.Input, responsesMessage{Type: "message", Role: "assistant", Content: []responsesContent{{Type: "output_text", Text: msg.Content}}})
+			}
+			for _, tc := range msg.ToolCalls {
+				req.Input = append(req.Input, responsesCall{Type: "function_call", CallID: tc.ID, Name: tc.Name, Arguments: tc.Args})
+			}
+		case "tool":
+			var images []types.Image
+			for _, tr := range msg.ToolResults {
+				req.Input = append(req.Input, responsesOutput{Type: "function_call_output", CallID: tr.ToolCallID, Output: tr.Content})
+				images = append(images, tr.Images...)
+			}
+			// Function outputs are text only, so images follow as a user message
+			if len(images) > 0 {
+				content := inputContent("Images returned by the tool calls above:", images)
+				req.Input = append(req.Input, responsesMessage{Type: "message", Role: "user", Content: content})
+			}
+		}
+	}
+	for _, t := range tools {
+		req.Tools = append(req.Tools, responsesTool{Type: "function", Name: t.Name, Description: t.Description, Parameters: t.InputSchema})
+	}
+	return req, nil
+}
+
+func inputContent(text string, images []types.Image) []responsesContent {
+	var content []responsesContent
+	if text != "" {
+		content = append(content, responsesContent{Type: "input_text", Text: text})
+	}
+	for _, img := range images {
+		data, err := encodeImage(img)
+		if err != nil {
+			content = append(content, responsesContent{Type: "input_text", Text: imageNote(err)})
+			continue
+		}
+		content = append(content, responsesContent{Type: "input_image", ImageURL: "data:" + img.MediaType + ";base64," + data})
+	}
+	return content
+}
+
+func (p *ResponsesProvider) post(ctx context.Context, lg logger.Logger, req responsesRequest, extra map[string]any) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err == nil {
+		body, err = mergeBody(body, extra)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if debug, _ := json.MarshalIndent(req, "", "  "); debug != nil {
+		lg.WriteJSON(fmt.Sprintf("request_%s_openai_responses.json", time.Now().Format("150405")), debug)
+	}
+	lg.Debug("openai responses request", "model", p.model, "items", len(req.Input), "tools", len(req.Tools), "stream", req.Stream)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/responses", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	for k, v := range p.headers {
+		httpReq.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			msg = apiErr.Error.Message
+		}
+		lg.Error("openai responses request failed", "status", resp.Status, "error", msg)
+		return nil, fmt.Errorf("openai responses: %s: %s", resp.Status, msg)
+	}
+	return resp, nil
+}
+
+func (p *ResponsesProvider) Chat(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (*Response, error) {
+	params := paramsFrom(ctx)
+	req, err := p.buildRequest(params, messages, tools, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.post(ctx, lg, req, params.ExtraBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result responsesResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("openai responses: decode response: %w", err)
+	}
+	return p.parse(lg, result, messages)
+}
+
+// ChatStream streams text deltas; the full response, with its reasoning
+// items and calls, comes from the final response.completed event
+func (p *ResponsesProvider) ChatStream(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (<-chan StreamChunk, <-chan *Response) {
+	chunkCh := make(chan StreamChunk, 16)
+	respCh := make(chan *Response, 1)
+
+	go func() {
+		defer close(chunkCh)
+		defer close(respCh)
+
+		params := paramsFrom(ctx)
+		req, err := p.buildRequest(params, messages, tools, true)
+		if err != nil {
+			chunkCh <- StreamChunk{Error: err}
+			return
+		}
+		resp, err := p.post(ctx, lg, req, params.ExtraBody)
+		if err != nil {
+			chunkCh <- StreamChunk{Error: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		var final *responsesResult
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64<<10), 16<<20)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+			var ev struct {
+				Type     string           `json:"type"`
+				Delta    string           `json:"delta"`
+				Message  string           `json:"message"`
+				Response *responsesResult `json:"response"`
+			}
+			if json.Unmarshal([]byte(data), &ev) != nil {
+				continue
+			}
+			switch ev.Type {
+			case "response.output_text.delta":
+				chunkCh <- StreamChunk{Content: ev.Delta}
+			case "response.completed", "response.incomplete", "response.failed":
+				final = ev.Response
+			case "error":
+				chunkCh <- StreamChunk{Error: fmt.Errorf("openai responses: %s", ev.Message)}
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			chunkCh <- StreamChunk{Error: err}
+			return
+		}
+		if final == nil {
+			chunkCh <- StreamChunk{Error: fmt.Errorf("openai responses: stream ended without a response")}
+			return
+		}
+		out, err := p.parse(lg, *final, messages)
+		if err != nil {
+			chunkCh <- StreamChunk{Error: err}
+			return
+		}
+		respCh <- out
+	}()
+
+	return chunkCh, respCh
+}
+
+func (p *ResponsesProvider) parse(lg logger.Logger, result responsesResult, messages []Message) (*Response, error) {
+	if result.Error != nil && result.Error.Message != "" {
+		return nil, fmt.Errorf("openai responses: %s", result.Error.Message)
+	}
+
+	resp := &Response{StopReason: result.Status}
+	if result.IncompleteDetails != nil && result.IncompleteDetails.Reason != "" {
+		resp.StopReason = result.IncompleteDetails.Reason
+	}
+	var text, reasoning strings.Builder
+	for _, raw := range result.Output {
+		var item outputItem
+		if json.Unmarshal(raw, &item) != nil {
+			continue
+		}
+		switch item.Type {
+		case "reasoning":
+			resp.ReasoningItems = append(resp.ReasoningItems, raw)
+			for _, s := range item.Summary {
+				reasoning.WriteString(s.Text)
+			}
+		case "message":
+			for _, c := range item.Content {
+				if c.Type == "output_text" {
+					text.WriteString(c.Text)
+				}
+			}
+		case "function_call":
+			resp.ToolCalls = append(resp.ToolCalls, types.ToolCall{ID: item.CallID, Name: item.Name, Args: item.Arguments})
+		}
+	}
+	resp.Content = text.String()
+	resp.ReasoningContent = reasoning.String()
+
+	resp.InputTokens = result.Usage.InputTokens
+	if resp.InputTokens == 0 {
+		resp.InputTokens = EstimateMessagesTokens(messages, p.model)
+	}
+	resp.OutputTokens = result.Usage.OutputTokens
+	if resp.OutputTokens == 0 {
+		resp.OutputTokens = EstimateOutputTokens(resp.Content, resp.ToolCalls, p.model)
+	}
+	lg.Info("openai responses received", "usage_input", result.Usage.InputTokens, "usage_output", result.Usage.OutputTokens, "reasoning_items", len(resp.ReasoningItems))
+	return resp, nil
+}
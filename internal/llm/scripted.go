@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+// Step answers one call of a ScriptedProvider. It sees what the call was
+// sent, so a script can check the conversation or answer based on it.
+type Step func(messages []Message, tools []Tool) (*Response, error)
+
+// ScriptedProvider answers calls with its steps in order, for tests that
+// drive the agent without a model
+type ScriptedProvider struct {
+	mu       sync.Mutex
+	steps    []Step
+	requests [][]Message
+}
+
+func NewScriptedProvider(steps ...Step) *ScriptedProvider {
+	return &ScriptedProvider{steps: steps}
+}
+
+// Reply answers with text and no tool calls, ending the turn
+func Reply(text string) Step {
+	return func(messages []Message, _ []Tool) (*Response, error) {
+		return scriptedResponse(messages, text, nil), nil
+	}
+}
+
+// CallTool answers with a single tool call. Arguments are JSON.
+func CallTool(name, args string) Step {
+	return CallTools(types.ToolCall{Name: name, Args: args})
+}
+
+// CallTools answers with the calls, numbering those without an ID
+func CallTools(calls ...types.ToolCall) Step {
+	return func(messages []Message, _ []Tool) (*Response, error) {
+		calls := append([]types.ToolCall(nil), calls...)
+		for i := range calls {
+			if calls[i].ID == "" {
+				calls[i].ID = fmt.Sprintf("call_%d_%d", len(messages), i)
+			}
+		}
+		return scriptedResponse(messages, "", calls), nil
+	}
+}
+
+// Fail makes the call return err
+func Fail(err error) Step {
+	return func([]Message, []Tool) (*Response, error) { return nil, err }
+}
+
+func scriptedResponse(messages []Message, text string, calls []types.ToolCall) *Response {
+	stop := "end_turn"
+	if len(calls) > 0 {
+		stop = "tool_use"
+	}
+	return &Response{
+		Content:      text,
+		ToolCalls:    calls,
+		StopReason:   stop,
+		InputTokens:  roughTokens(messages),
+		OutputTokens: roughTokens([]Message{{Content: text, ToolCalls: calls}}),
+	}
+}
+
+// roughTokens counts about four characters a token, as tiktoken may need
+// the network to load its encodings
+func roughTokens(messages []Message) int64 {
+	var n int
+	for _, m := range messages {
+		n += len(m.Content) + 16
+		for _, tc := range m.ToolCalls {
+			n += len(tc.Name) + len(tc.Args)
+		}
+		for _, tr := range m.ToolResults {
+			n += len(tr.Content)
+		}
+	}
+	return int64(n / 4)
+}
+
+// Requests returns the messages each call was sent, in order
+func (p *ScriptedProvider) Requests() [][]Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]Message(nil), p.requests...)
+}
+
+// Remaining reports how many steps haven't been used
+func (p *ScriptedProvider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.steps)
+}
+
+func (p *ScriptedProvider) Chat(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	n := len(p.requests)
+	p.requests = append(p.requests, append([]Message(nil), messages...))
+	if len(p.steps) == 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("scripted provider: no step left for call %d", n+1)
+	}
+	step := p.steps[0]
+	p.steps = p.steps[1:]
+	p.mu.Unlock()
+	return step(messages, tools)
+}
+
+// ChatStream streams the step's text word by word
+func (p *ScriptedProvider) ChatStream(ctx context.Context, lg logger.Logger, messages []Message, tools []Tool, toolResults []types.ToolResult) (<-chan StreamChunk, <-chan *Response) {
+	chunkCh := make(chan StreamChunk, 100)
+	respCh := make(chan *Response, 1)
+	go func() {
+		defer close(chunkCh)
+		defer close(respCh)
+		resp, err := p.Chat(ctx, lg, messages, tools, toolResults)
+		if err != nil {
+			chunkCh <- StreamChunk{Error: err}
+			respCh <- nil
+			return
+		}
+		for _, word := range strings.SplitAfter(resp.Content, " ") {
+			if word != "" {
+				chunkCh <- StreamChunk{Content: word}
+			}
+		}
+		respCh <- resp
+	}()
+	return chunkCh, respCh
+}
@@ -1,26 +1,46 @@
 package llm
 
 import (
+	"sync"
+
 	"github.com/abcdlsj/otter/internal/types"
 	"github.com/pkoukk/tiktoken-go"
 )
 
-// estimateTokens uses tiktoken to estimate token count for text
-func estimateTokens(text string, model string) int64 {
+type encoder struct {
+	once sync.Once
+	tkm  *tiktoken.Tiktoken
+	err  error
+}
+
+var encoders sync.Map // encoding name -> *encoder
+
+// getEncoder loads each encoding once; building one is expensive and may hit the network
+func getEncoder(encoding string) (*tiktoken.Tiktoken, error) {
+	v, _ := encoders.LoadOrStore(encoding, &encoder{})
+	e := v.(*encoder)
+	e.once.Do(func() {
+		e.tkm, e.err = tiktoken.GetEncoding(encoding)
+	})
+	return e.tkm, e.err
+}
+
+// EstimateTokens uses tiktoken to estimate token count for text
+func EstimateTokens(text string, model string) int64 {
 	encoding := "cl100k_base" // default for gpt-4, gpt-3.5, text-embedding-ada-002
-	
+
 	// Map common models to their encodings
 	switch model {
 	case "gpt-4o", "gpt-4o-mini":
 		encoding = "o200k_base"
 	}
-	
-	tkm, err := tiktoken.GetEncoding(encoding)
+
+	tkm, err := getEncoder(encoding)
 	if err != nil {
 		// Fallback: rough estimate ~4 chars per token
 		return int64(len(text) / 4)
 	}
-	
+
 	tokens := tkm.Encode(text, nil, nil)
 	return int64(len(tokens))
 }
@@ -29,18 +49,35 @@ func estimateTokens(text string, model string) int64 {
 func EstimateMessagesTokens(messages []Message, model string) int64 {
 	var total int64
 	for _, msg := range messages {
-		total += estimateTokens(msg.Content, model)
+		total += EstimateTokens(msg.Content, model)
 		total += 4
+		for _, img := range msg.Images {
+			total += EstimateImageTokens(img)
+		}
+		for _, tr := range msg.ToolResults {
+			for _, img := range tr.Images {
+				total += EstimateImageTokens(img)
+			}
+		}
 	}
 	return total
 }
 
+// EstimateImageTokens approximates an image's cost as width*height/750,
+// capped where providers downscale large images
+func EstimateImageTokens(img types.Image) int64 {
+	if img.Width <= 0 || img.Height <= 0 {
+		return 1000
+	}
+	return min(int64(img.Width*img.Height/750), 1600)
+}
+
 // EstimateOutputTokens estimates output tokens from content and tool calls
 func EstimateOutputTokens(content string, toolCalls []types.ToolCall, model string) int64 {
-	total := estimateTokens(content, model)
+	total := EstimateTokens(content, model)
 	for _, tc := range toolCalls {
-		total += estimateTokens(tc.Name, model)
-		total += estimateTokens(tc.Args, model)
+		total += EstimateTokens(tc.Name, model)
+		total += EstimateTokens(tc.Args, model)
 		total += 4
 	}
 	return total
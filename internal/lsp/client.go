@@ -0,0 +1,339 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/logger"
+)
+
+// diagnosticsSettle is how long to keep collecting after the first publish;
+// servers like gopls publish parse errors first and type errors shortly after
+const diagnosticsSettle = 500 * time.Millisecond
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Client talks JSON-RPC to one language server process over stdio
+type Client struct {
+	name string
+	root string
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan message
+	docs    map[string]int // open document URI -> version
+	diags   map[string][]Diagnostic
+	waiters map[string][]chan struct{}
+	done    chan struct{}
+}
+
+// Start launches the server and performs the initialize handshake
+func Start(ctx context.Context, name string, command []string, root string) (*Client, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("lsp %s: no command configured", name)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = root
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("lsp %s: %w", name, err)
+	}
+
+	c := &Client{
+		name:    name,
+		root:    root,
+		cmd:     cmd,
+		in:      in,
+		pending: make(map[int64]chan message),
+		docs:    make(map[string]int),
+		diags:   make(map[string][]Diagnostic),
+		waiters: make(map[string][]chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(out))
+
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   PathToURI(root),
+		"workspaceFolders": []map[string]string{
+			{"uri": PathToURI(root), "name": name},
+		},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"publishDiagnostics": map[string]any{},
+				"synchronization":    map[string]any{"didSave": true},
+				"hover":              map[string]any{"contentFormat": []string{"plaintext", "markdown"}},
+				"documentSymbol":     map[string]any{"hierarchicalDocumentSymbolSupport": true},
+			},
+			"workspace": map[string]any{
+				"workspaceFolders": true,
+				"configuration":    true,
+			},
+		},
+	}
+	if err := c.Call(ctx, "initialize", params, nil); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("lsp %s initialize: %w", name, err)
+	}
+	if err := c.Notify("initialized", map[string]any{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	logger.Info("lsp started", "name", name, "root", root)
+	return c, nil
+}
+
+func (c *Client) Name() string { return c.name }
+
+// Call sends a request and decodes the result into result (if non-nil)
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	raw := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.write(message{ID: &raw, Method: method, Params: mustJSON(params)}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return fmt.Errorf("lsp %s exited", c.name)
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %s", method, resp.Error.Message)
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	}
+}
+
+// Notify sends a notification
+func (c *Client) Notify(method string, params any) error {
+	return c.write(message{Method: method, Params: mustJSON(params)})
+}
+
+func (c *Client) write(m message) error {
+	m.JSONRPC = "2.0"
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.in.Write(data)
+	return err
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	defer close(c.done)
+	for {
+		m, err := readMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				logger.Warn("lsp read failed", "name", c.name, "err", err)
+			}
+			return
+		}
+		switch {
+		case m.ID != nil && m.Method != "":
+			c.handleServerRequest(m)
+		case m.ID != nil:
+			id, _ := strconv.ParseInt(string(*m.ID), 10, 64)
+			c.mu.Lock()
+			ch := c.pending[id]
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- m
+			}
+		case m.Method == "textDocument/publishDiagnostics":
+			var p publishDiagnosticsParams
+			if json.Unmarshal(m.Params, &p) == nil {
+				c.mu.Lock()
+				c.diags[p.URI] = p.Diagnostics
+				for _, w := range c.waiters[p.URI] {
+					close(w)
+				}
+				delete(c.waiters, p.URI)
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+// handleServerRequest answers requests from the server so it never blocks on us
+func (c *Client) handleServerRequest(m message) {
+	var result any
+	if m.Method == "workspace/configuration" {
+		var p struct {
+			Items []any `json:"items"`
+		}
+		json.Unmarshal(m.Params, &p)
+		result = make([]any, len(p.Items))
+	}
+	c.write(message{ID: m.ID, Result: mustJSON(result)})
+}
+
+func readMessage(r *bufio.Reader) (message, error) {
+	length := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return message{}, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			length, _ = strconv.Atoi(strings.TrimSpace(v))
+		}
+	}
+	if length <= 0 {
+		return message{}, fmt.Errorf("missing Content-Length")
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return message{}, err
+	}
+	var m message
+	err := json.Unmarshal(buf, &m)
+	return m, err
+}
+
+func mustJSON(v any) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// Sync tells the server about the current content of path, opening it if needed
+func (c *Client) Sync(path, text string) error {
+	uri := PathToURI(path)
+	c.mu.Lock()
+	version, open := c.docs[uri]
+	version++
+	c.docs[uri] = version
+	c.mu.Unlock()
+
+	if !open {
+		return c.Notify("textDocument/didOpen", map[string]any{
+			"textDocument": textDocumentItem{URI: uri, LanguageID: languageID(path), Version: version, Text: text},
+		})
+	}
+	return c.Notify("textDocument/didChange", map[string]any{
+		"textDocument":   versionedTextDocumentIdentifier{URI: uri, Version: version},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+// SyncFile reads path from disk and syncs it
+func (c *Client) SyncFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return c.Sync(path, string(data))
+}
+
+// Diagnostics syncs path and waits for the server to publish diagnostics for it
+func (c *Client) Diagnostics(ctx context.Context, path string) ([]Diagnostic, error) {
+	uri := PathToURI(path)
+	wait := c.waitDiagnostics(uri)
+	if err := c.SyncFile(path); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, fmt.Errorf("lsp %s exited", c.name)
+	case <-wait:
+	}
+
+	// Keep taking newer publishes until the server goes quiet
+	for {
+		next := c.waitDiagnostics(uri)
+		select {
+		case <-next:
+			continue
+		case <-time.After(diagnosticsSettle):
+		case <-ctx.Done():
+		}
+		break
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.diags[uri], nil
+}
+
+func (c *Client) waitDiagnostics(uri string) <-chan struct{} {
+	ch := make(chan struct{})
+	c.mu.Lock()
+	c.waiters[uri] = append(c.waiters[uri], ch)
+	c.mu.Unlock()
+	return ch
+}
+
+// Close shuts the server down, killing it if it does not exit promptly
+func (c *Client) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	c.Call(ctx, "shutdown", nil, nil)
+	c.Notify("exit", nil)
+	c.in.Close()
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+		c.cmd.Process.Kill()
+	}
+	c.cmd.Wait()
+}
@@ -0,0 +1,141 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/logger"
+)
+
+// Manager starts configured language servers on first use and keeps them
+// for the rest of the session, one per server and workspace root
+type Manager struct {
+	configs []config.LSPConfig
+
+	mu      sync.Mutex
+	clients map[string]*Client
+	failed  map[string]startFailure
+}
+
+// startFailure is a server that couldn't start, not retried until retryAt
+type startFailure struct {
+	err     error
+	retryAt time.Time
+}
+
+// retryStartAfter is how long a server that failed to start is left alone
+const retryStartAfter = time.Minute
+
+func NewManager(configs []config.LSPConfig) *Manager {
+	return &Manager{
+		configs: configs,
+		clients: make(map[string]*Client),
+		failed:  make(map[string]startFailure),
+	}
+}
+
+var (
+	shared     *Manager
+	sharedOnce sync.Once
+)
+
+// defaultServers is used when no [[lsp]] entries are configured
+var defaultServers = []config.LSPConfig{
+	{Name: "gopls", Command: []string{"gopls"}, Match: []string{"*.go"}},
+}
+
+// Shared returns the session-wide manager built from config.C.LSP
+func Shared() *Manager {
+	sharedOnce.Do(func() {
+		configs := config.C.LSP
+		if len(configs) == 0 {
+			configs = defaultServers
+		}
+		shared = NewManager(configs)
+	})
+	return shared
+}
+
+// Configured reports whether any server handles path
+func (m *Manager) Configured(path string) bool {
+	_, ok := m.match(path)
+	return ok
+}
+
+// For returns a running client for path, starting it if needed. An empty
+// path selects the first configured server.
+func (m *Manager) For(ctx context.Context, path string) (*Client, error) {
+	cfg, ok := m.match(path)
+	if path == "" && len(m.configs) > 0 {
+		cfg, ok = m.configs[0], true
+	}
+	if !ok {
+		return nil, fmt.Errorf("no language server configured for %s", filepath.Base(path))
+	}
+	root, _ := os.Getwd()
+	key := cfg.Name + "\x00" + root
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.clients[key]; ok {
+		select {
+		case <-c.done:
+			delete(m.clients, key)
+		default:
+			return c, nil
+		}
+	}
+	// Don't keep retrying a server that is missing or crashes on startup
+	if f, ok := m.failed[key]; ok && time.Now().Before(f.retryAt) {
+		return nil, f.err
+	}
+
+	c, err := Start(ctx, cfg.Name, cfg.Command, root)
+	if err != nil {
+		logger.Warn("lsp start failed", "name", cfg.Name, "err", err)
+		// A caller's timeout says nothing about the server, so the next
+		// call tries again
+		if ctx.Err() == nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+			m.failed[key] = startFailure{err: err, retryAt: time.Now().Add(retryStartAfter)}
+		}
+		return nil, err
+	}
+	delete(m.failed, key)
+	m.clients[key] = c
+	return c, nil
+}
+
+func (m *Manager) match(path string) (config.LSPConfig, bool) {
+	base := filepath.Base(path)
+	for _, cfg := range m.configs {
+		for _, pattern := range cfg.Match {
+			if ok, _ := filepath.Match(pattern, base); ok {
+				return cfg, true
+			}
+			if ok, _ := filepath.Match(pattern, path); ok {
+				return cfg, true
+			}
+			if strings.HasPrefix(pattern, ".") && strings.HasSuffix(base, pattern) {
+				return cfg, true
+			}
+		}
+	}
+	return config.LSPConfig{}, false
+}
+
+// Close stops every running server
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, c := range m.clients {
+		c.Close()
+		delete(m.clients, key)
+	}
+}
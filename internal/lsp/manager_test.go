@@ -0,0 +1,28 @@
+package lsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/config"
+)
+
+func TestForRetriesAfterTimeout(t *testing.T) {
+	m := NewManager([]config.LSPConfig{{Name: "missing", Command: []string{"otter-no-such-server"}, Match: []string{"*.go"}}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.For(ctx, "main.go"); err == nil {
+		t.Fatal("started a missing server")
+	}
+	if len(m.failed) != 0 {
+		t.Errorf("a cancelled start was remembered as a failure: %v", m.failed)
+	}
+
+	if _, err := m.For(context.Background(), "main.go"); err == nil {
+		t.Fatal("started a missing server")
+	}
+	if len(m.failed) != 1 {
+		t.Errorf("a missing server wasn't remembered")
+	}
+}
@@ -0,0 +1,225 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+var symbolKinds = map[int]string{
+	1: "file", 2: "module", 3: "namespace", 4: "package", 5: "class", 6: "method",
+	7: "property", 8: "field", 9: "constructor", 10: "enum", 11: "interface",
+	12: "function", 13: "variable", 14: "constant", 15: "string", 16: "number",
+	17: "boolean", 18: "array", 19: "object", 20: "key", 21: "null",
+	22: "enum member", 23: "struct", 24: "event", 25: "operator", 26: "type parameter",
+}
+
+// SymbolKindName returns a readable name for an LSP SymbolKind
+func SymbolKindName(kind int) string {
+	if s, ok := symbolKinds[kind]; ok {
+		return s
+	}
+	return "symbol"
+}
+
+// Symbol is a document or workspace symbol flattened to one location
+type Symbol struct {
+	Name      string
+	Kind      int
+	Container string
+	Location  Location
+	Depth     int
+}
+
+type documentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []documentSymbol `json:"children,omitempty"`
+
+	// SymbolInformation fields, for servers without hierarchical support
+	Location      *Location `json:"location,omitempty"`
+	ContainerName string    `json:"containerName,omitempty"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type workspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []struct {
+		TextDocument versionedTextDocumentIdentifier `json:"textDocument"`
+		Edits        []TextEdit                      `json:"edits"`
+	} `json:"documentChanges,omitempty"`
+}
+
+func (c *Client) positionParams(path string, pos Position) textDocumentPositionParams {
+	return textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: PathToURI(path)},
+		Position:     pos,
+	}
+}
+
+// Definition returns where the symbol at pos is defined
+func (c *Client) Definition(ctx context.Context, path string, pos Position) ([]Location, error) {
+	if err := c.SyncFile(path); err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := c.Call(ctx, "textDocument/definition", c.positionParams(path, pos), &raw); err != nil {
+		return nil, err
+	}
+	return decodeLocations(raw), nil
+}
+
+// References returns every use of the symbol at pos, including its declaration
+func (c *Client) References(ctx context.Context, path string, pos Position) ([]Location, error) {
+	if err := c.SyncFile(path); err != nil {
+		return nil, err
+	}
+	params := map[string]any{
+		"textDocument": textDocumentIdentifier{URI: PathToURI(path)},
+		"position":     pos,
+		"context":      map[string]bool{"includeDeclaration": true},
+	}
+	var locs []Location
+	err := c.Call(ctx, "textDocument/references", params, &locs)
+	return locs, err
+}
+
+// Hover returns the type information and docs for the symbol at pos
+func (c *Client) Hover(ctx context.Context, path string, pos Position) (string, error) {
+	if err := c.SyncFile(path); err != nil {
+		return "", err
+	}
+	var result struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := c.Call(ctx, "textDocument/hover", c.positionParams(path, pos), &result); err != nil {
+		return "", err
+	}
+	return hoverText(result.Contents), nil
+}
+
+// DocumentSymbols returns the symbols declared in path, outermost first
+func (c *Client) DocumentSymbols(ctx context.Context, path string) ([]Symbol, error) {
+	if err := c.SyncFile(path); err != nil {
+		return nil, err
+	}
+	params := map[string]any{"textDocument": textDocumentIdentifier{URI: PathToURI(path)}}
+	var raw []documentSymbol
+	if err := c.Call(ctx, "textDocument/documentSymbol", params, &raw); err != nil {
+		return nil, err
+	}
+	var out []Symbol
+	var walk func(ds []documentSymbol, container string, depth int)
+	walk = func(ds []documentSymbol, container string, depth int) {
+		for _, d := range ds {
+			s := Symbol{Name: d.Name, Kind: d.Kind, Container: container, Depth: depth}
+			if d.Location != nil {
+				s.Location = *d.Location
+				s.Container = d.ContainerName
+			} else {
+				s.Location = Location{URI: PathToURI(path), Range: d.SelectionRange}
+			}
+			out = append(out, s)
+			walk(d.Children, d.Name, depth+1)
+		}
+	}
+	walk(raw, "", 0)
+	return out, nil
+}
+
+// WorkspaceSymbols searches symbols across the workspace
+func (c *Client) WorkspaceSymbols(ctx context.Context, query string) ([]Symbol, error) {
+	var raw []documentSymbol
+	if err := c.Call(ctx, "workspace/symbol", map[string]string{"query": query}, &raw); err != nil {
+		return nil, err
+	}
+	out := make([]Symbol, 0, len(raw))
+	for _, d := range raw {
+		if d.Location == nil {
+			continue
+		}
+		out = append(out, Symbol{Name: d.Name, Kind: d.Kind, Container: d.ContainerName, Location: *d.Location})
+	}
+	return out, nil
+}
+
+// Rename computes the edits that renaming the symbol at pos would make,
+// keyed by file path. Nothing is written.
+func (c *Client) Rename(ctx context.Context, path string, pos Position, newName string) (map[string][]TextEdit, error) {
+	if err := c.SyncFile(path); err != nil {
+		return nil, err
+	}
+	params := map[string]any{
+		"textDocument": textDocumentIdentifier{URI: PathToURI(path)},
+		"position":     pos,
+		"newName":      newName,
+	}
+	var we workspaceEdit
+	if err := c.Call(ctx, "textDocument/rename", params, &we); err != nil {
+		return nil, err
+	}
+	edits := make(map[string][]TextEdit)
+	for uri, es := range we.Changes {
+		edits[URIToPath(uri)] = append(edits[URIToPath(uri)], es...)
+	}
+	for _, dc := range we.DocumentChanges {
+		p := URIToPath(dc.TextDocument.URI)
+		edits[p] = append(edits[p], dc.Edits...)
+	}
+	return edits, nil
+}
+
+// decodeLocations accepts Location, []Location or []LocationLink
+func decodeLocations(raw json.RawMessage) []Location {
+	var one Location
+	if json.Unmarshal(raw, &one) == nil && one.URI != "" {
+		return []Location{one}
+	}
+	var items []struct {
+		Location
+		TargetURI            string `json:"targetUri"`
+		TargetSelectionRange Range  `json:"targetSelectionRange"`
+	}
+	json.Unmarshal(raw, &items)
+	var locs []Location
+	for _, it := range items {
+		if it.TargetURI != "" {
+			locs = append(locs, Location{URI: it.TargetURI, Range: it.TargetSelectionRange})
+		} else if it.URI != "" {
+			locs = append(locs, it.Location)
+		}
+	}
+	return locs
+}
+
+// hoverText flattens MarkupContent, MarkedString or []MarkedString
+func hoverText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var mc struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &mc) == nil && mc.Value != "" {
+		return mc.Value
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(raw, &parts) == nil {
+		var out []string
+		for _, p := range parts {
+			if t := hoverText(p); t != "" {
+				out = append(out, t)
+			}
+		}
+		return strings.Join(out, "\n\n")
+	}
+	return ""
+}
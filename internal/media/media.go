@@ -0,0 +1,113 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+// MaxImageBytes is the largest image sent to a model
+const MaxImageBytes = 5 << 20
+
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// IsImage reports whether path has a supported image extension
+func IsImage(path string) bool {
+	_, ok := imageTypes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// LoadImage reads an image file, checking its size and that its content
+// matches a supported format
+func LoadImage(path string) (types.Image, error) {
+	if !config.C.CheckReadPermission(path) {
+		return types.Image{}, fmt.Errorf("permission denied: cannot read %s", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.Image{}, err
+	}
+	if info.Size() > MaxImageBytes {
+		return types.Image{}, fmt.Errorf("%s is %d KB, images are limited to %d KB", path, info.Size()>>10, MaxImageBytes>>10)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.Image{}, err
+	}
+
+	mediaType := http.DetectContentType(data)
+	if !isSupported(mediaType) {
+		return types.Image{}, fmt.Errorf("%s is not a PNG, JPEG, GIF or WebP image (%s)", path, mediaType)
+	}
+	img := types.Image{Path: path, MediaType: mediaType, Data: data}
+	// WebP has no decoder in the standard library, so its size stays unknown
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		img.Width, img.Height = cfg.Width, cfg.Height
+	}
+	return img, nil
+}
+
+func isSupported(mediaType string) bool {
+	for _, t := range imageTypes {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Store copies the image into the session image directory so history keeps
+// working after the original file changes or goes away
+func Store(img types.Image) (types.Image, error) {
+	data, err := img.Bytes()
+	if err != nil {
+		return img, err
+	}
+	sum := sha256.Sum256(data)
+	ext := strings.ToLower(filepath.Ext(img.Path))
+	if ext == "" {
+		ext = "." + strings.TrimPrefix(img.MediaType, "image/")
+	}
+	path := filepath.Join(config.SessionsDir(), "images", hex.EncodeToString(sum[:8])+ext)
+	if _, err := os.Stat(path); err != nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return img, err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return img, err
+		}
+	}
+	img.Path = path
+	img.Data = data
+	return img, nil
+}
+
+// Label describes an image in one line: name, dimensions and size
+func Label(img types.Image) string {
+	label := filepath.Base(img.Path)
+	if img.Width > 0 {
+		label += fmt.Sprintf(" %dx%d", img.Width, img.Height)
+	}
+	if img.Data != nil {
+		label += fmt.Sprintf(" %d KB", (len(img.Data)+1023)>>10)
+	}
+	return label
+}
@@ -0,0 +1,201 @@
+package mode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/logger"
+)
+
+// Mode shapes an agent run: its prompt, and optionally the model, tools,
+// step budget and request params
+type Mode struct {
+	Name        string
+	Description string
+	Model       string             // provider/model or alias, "" for the current model
+	Tools       []string           // allowed tools, empty for all
+	MaxSteps    int                // 0 for config.C.MaxSteps
+	Params      config.ModelParams // over the model's params
+	Prompt      string             // custom prompt body, "" for built-in modes
+	Source      string             // where the mode was defined
+}
+
+// Builtin reports whether m uses one of the prompts compiled into otter
+func (m Mode) Builtin() bool { return m.Prompt == "" }
+
+var builtins = []Mode{
+	{Name: "default", Description: "Full coding assistant", Source: "builtin"},
+	{Name: "plan", Description: "Read-only exploration and planning", Source: "builtin"},
+	{Name: "explore", Description: "Quickly find and explain code", Source: "builtin"},
+}
+
+// Default returns the built-in default mode
+func Default() Mode { return builtins[0] }
+
+// All returns every mode: built-ins, then [[modes]] from config, then
+// ~/.config/otter/modes/*.md, then .otter/modes/*.md. A later definition
+// replaces an earlier one with the same name.
+func All() []Mode {
+	modes := slices.Clone(builtins)
+	add := func(m Mode) {
+		if i := slices.IndexFunc(modes, func(x Mode) bool { return x.Name == m.Name }); i >= 0 {
+			modes[i] = m
+			return
+		}
+		modes = append(modes, m)
+	}
+
+	for _, c := range config.C.Modes {
+		if c.Name == "" {
+			continue
+		}
+		params := c.Params
+		if params.Temperature == nil {
+			params.Temperature = c.Temperature
+		}
+		add(Mode{
+			Name:        c.Name,
+			Description: c.Description,
+			Model:       c.Model,
+			Tools:       c.Tools,
+			MaxSteps:    c.MaxSteps,
+			Params:      params,
+			Prompt:      strings.TrimSpace(c.Prompt),
+			Source:      "config",
+		})
+	}
+	for _, dir := range []string{filepath.Join(config.Home(), "modes"), filepath.Join(".otter", "modes")} {
+		for _, m := range loadDir(dir) {
+			add(m)
+		}
+	}
+	return modes
+}
+
+// Find looks a mode up by name
+func Find(name string) (Mode, bool) {
+	for _, m := range All() {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Mode{}, false
+}
+
+func loadDir(dir string) []Mode {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+	slices.Sort(paths)
+	var modes []Mode
+	for _, path := range paths {
+		m, err := loadFile(path)
+		if err != nil {
+			logger.Warn("skip mode file", "path", path, "err", err)
+			continue
+		}
+		modes = append(modes, m)
+	}
+	return modes
+}
+
+// loadFile parses a markdown mode: optional "---" frontmatter with
+// name, description, model, tools, max_steps and the params temperature,
+// top_p, max_tokens, stop and reasoning_effort, then the prompt
+func loadFile(path string) (Mode, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Mode{}, err
+	}
+	m := Mode{Name: strings.TrimSuffix(filepath.Base(path), ".md"), Source: path}
+
+	meta, body := splitFrontmatter(string(data))
+	for key, value := range meta {
+		switch key {
+		case "name":
+			m.Name = value
+		case "description":
+			m.Description = value
+		case "model":
+			m.Model = value
+		case "tools":
+			m.Tools = parseList(value)
+		case "max_steps":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Mode{}, fmt.Errorf("max_steps: %w", err)
+			}
+			m.MaxSteps = n
+		case "temperature", "top_p":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Mode{}, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "top_p" {
+				m.Params.TopP = &f
+			} else {
+				m.Params.Temperature = &f
+			}
+		case "max_tokens":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Mode{}, fmt.Errorf("max_tokens: %w", err)
+			}
+			m.Params.MaxTokens = n
+		case "stop":
+			m.Params.Stop = parseList(value)
+		case "reasoning_effort":
+			m.Params.ReasoningEffort = value
+		}
+	}
+
+	m.Prompt = strings.TrimSpace(body)
+	if m.Prompt == "" {
+		return Mode{}, fmt.Errorf("empty prompt")
+	}
+	return m, nil
+}
+
+func splitFrontmatter(s string) (map[string]string, string) {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	meta := make(map[string]string)
+	rest, ok := strings.CutPrefix(s, "---\n")
+	if !ok {
+		return meta, s
+	}
+	head, body, ok := strings.Cut(rest, "\n---")
+	if !ok {
+		return meta, s
+	}
+	for _, line := range strings.Split(head, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		meta[strings.TrimSpace(key)] = unquote(strings.TrimSpace(value))
+	}
+	_, body, _ = strings.Cut(body, "\n")
+	return meta, body
+}
+
+// parseList accepts "[a, b]" or "a, b"
+func parseList(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]")
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = unquote(strings.TrimSpace(item)); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
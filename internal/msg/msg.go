@@ -3,19 +3,28 @@ package msg
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/abcdlsj/otter/internal/attach"
 	"github.com/abcdlsj/otter/internal/event"
+	"github.com/abcdlsj/otter/internal/llm"
 	"github.com/abcdlsj/otter/internal/logger"
 	"github.com/abcdlsj/otter/internal/types"
 	"github.com/google/uuid"
 )
 
+// maxSessionLine caps one persisted message. Images are saved by path, but
+// tool results and attachments can still make a line long.
+const maxSessionLine = 32 << 20
+
 type Msg struct {
 	ID          string             `json:"id"`
 	Session     string             `json:"session"`
@@ -23,7 +32,14 @@ type Msg struct {
 	Text        string             `json:"text"`
 	ToolCalls   []types.ToolCall   `json:"tool_calls,omitempty"`
 	ToolResults []types.ToolResult `json:"tool_results,omitempty"`
+	Attachments []types.Attachment `json:"attachments,omitempty"`
+	Images      []types.Image      `json:"images,omitempty"`
+	Usage       []types.Usage      `json:"usage,omitempty"`
+	Interrupted bool               `json:"interrupted,omitempty"` // marks a turn that stopped before finishing
 	Time        time.Time          `json:"time"`
+
+	// Opaque reasoning items (openai-responses) to send back on later turns
+	ReasoningItems []json.RawMessage `json:"reasoning_items,omitempty"`
 }
 
 func New(session, role, text string) Msg {
@@ -40,6 +56,48 @@ func User(session, text string) Msg   { return New(session, "user", text) }
 func Bot(session, text string) Msg    { return New(session, "assistant", text) }
 func System(session, text string) Msg { return New(session, "system", text) }
 
+// Interrupted is the marker saved after a turn that ended without an answer
+func Interrupted(session, reason string) Msg {
+	m := New(session, "system", "interrupted: "+reason)
+	m.Interrupted = true
+	return m
+}
+
+// UsageNote records a call made outside a turn, such as the title or a
+// /commit message, so the session's usage still counts it after a restart
+func UsageNote(session, text string, u types.Usage) Msg {
+	m := New(session, "system", text)
+	m.Usage = []types.Usage{u}
+	return m
+}
+
+// NewSessionID returns an ID for a new session, ordered by creation time
+func NewSessionID() string {
+	now := time.Now()
+	return fmt.Sprintf("%s_%03d", now.Format("20060102_150405"), now.Nanosecond()/1000000)
+}
+
+// ToLLM converts saved messages for the agent. System messages are notes
+// for the user, such as compaction and interruption markers, and are left out.
+func ToLLM(msgs []Msg) []llm.Message {
+	out := make([]llm.Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Role == "system" {
+			continue
+		}
+		out = append(out, llm.Message{
+			Role:        m.Role,
+			Content:     attach.Content(m.Text, m.Attachments),
+			Images:      m.Images,
+			ToolCalls:   m.ToolCalls,
+			ToolResults: m.ToolResults,
+
+			ReasoningItems: m.ReasoningItems,
+		})
+	}
+	return out
+}
+
 type Session struct {
 	ID        string    `json:"id"`
 	Title     string    `json:"title"`
@@ -68,6 +126,25 @@ func NewBus(dir string) *Bus {
 	return b
 }
 
+// Interrupted reports whether the last turn stopped before the assistant
+// answered, whether it was marked or Otter exited mid-turn
+func (s *Session) Interrupted() bool {
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		m := s.Messages[i]
+		switch {
+		case m.Interrupted:
+			return true
+		case m.Role == "system":
+			continue
+		case m.Role == "assistant" && len(m.ToolCalls) == 0:
+			return false
+		default:
+			return true
+		}
+	}
+	return false
+}
+
 func (b *Bus) GetSession(id string) *Session {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -113,6 +190,40 @@ func (b *Bus) DeleteSession(id string) {
 	}
 }
 
+// Fork copies a session into a new one, up to and including the message
+// at when it's given
+func (b *Bus) Fork(id, at string) (*Session, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	src, ok := b.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session %q not found", id)
+	}
+	msgs := src.Messages
+	if at != "" {
+		i := slices.IndexFunc(msgs, func(m Msg) bool { return m.ID == at })
+		if i < 0 {
+			return nil, fmt.Errorf("message %q not found in session %q", at, id)
+		}
+		msgs = msgs[:i+1]
+	}
+	now := time.Now()
+	s := &Session{
+		ID:        NewSessionID(),
+		Title:     src.Title,
+		Messages:  make([]Msg, 0, len(msgs)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, m := range msgs {
+		m.Session = s.ID
+		s.Messages = append(s.Messages, m)
+		b.appendMsg(m)
+	}
+	b.sessions[s.ID] = s
+	return s, nil
+}
+
 func (b *Bus) SetSessionTitle(id, title string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -187,28 +298,50 @@ func (b *Bus) HandleEvents(sessionID string, events <-chan event.Event) <-chan e
 	out := make(chan event.Event, 64)
 	go func() {
 		defer close(out)
+		finished := false
+		reason := "stopped"
 		for ev := range events {
-			out <- ev
 			b.pubEvent(sessionID, ev)
 			switch ev.Type {
 			case event.CompactEnd:
 				if data, ok := ev.Data.(event.CompactEndData); ok {
-					b.Pub(New(sessionID, "system",
-						fmt.Sprintf("[compact] %d → %d tokens", data.Before, data.After)))
+					m := New(sessionID, "system", fmt.Sprintf("[compact] %d → %d tokens", data.Before, data.After))
+					if data.Usage != nil {
+						m.Usage = []types.Usage{*data.Usage}
+					}
+					b.Pub(m)
+				}
+			case event.Step:
+				// Saved as they happen so a cancelled or crashed turn keeps its progress
+				if data, ok := ev.Data.(event.StepData); ok {
+					em := data.Message
+					m := New(sessionID, em.Role, em.Content)
+					m.ToolCalls = em.ToolCalls
+					m.ToolResults = em.ToolResults
+					m.Usage = em.Usage
+					m.ReasoningItems = em.ReasoningItems
+					b.Pub(m)
 				}
 			case event.Done:
-				if data, ok := ev.Data.(event.DoneData); ok {
-					for _, em := range data.Messages {
-						b.Pub(Msg{
-							Session:     sessionID,
-							Role:        em.Role,
-							Text:        em.Content,
-							ToolCalls:   em.ToolCalls,
-							ToolResults: em.ToolResults,
-						})
-					}
+				finished = true
+			case event.Paused:
+				if data, ok := ev.Data.(event.PausedData); ok {
+					reason = data.Reason
 				}
+				b.Pub(Interrupted(sessionID, reason))
+				finished = true
+			case event.Error:
+				if data, ok := ev.Data.(event.ErrorData); ok {
+					reason = data.Message
+				}
+				b.Pub(Interrupted(sessionID, reason))
+				finished = true
 			}
+			// Forward after saving so a new turn started on Done sees this one
+			out <- ev
+		}
+		if !finished {
+			b.Pub(Interrupted(sessionID, reason))
 		}
 	}()
 	return out
@@ -231,7 +364,10 @@ func (b *Bus) load() {
 			continue
 		}
 		sessionID := e.Name()
-		msgs := b.loadSession(sessionID)
+		msgs, err := b.loadSession(sessionID)
+		if err != nil {
+			logger.Warn("failed to read session", "id", sessionID, "err", err)
+		}
 		if len(msgs) == 0 {
 			continue
 		}
@@ -241,22 +377,28 @@ func (b *Bus) load() {
 	logger.Info("loaded sessions", "count", len(b.sessions))
 }
 
-func (b *Bus) loadSession(id string) []Msg {
+// loadSession reads a session log, returning the messages read before any
+// error
+func (b *Bus) loadSession(id string) ([]Msg, error) {
 	f, err := os.Open(filepath.Join(b.dir, id, "session.jsonl"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	defer f.Close()
 
 	var msgs []Msg
 	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSessionLine)
 	for scanner.Scan() {
 		var m Msg
 		if json.Unmarshal(scanner.Bytes(), &m) == nil {
 			msgs = append(msgs, m)
 		}
 	}
-	return msgs
+	return msgs, scanner.Err()
 }
 
 func (b *Bus) rebuildSession(id string, msgs []Msg) *Session {
@@ -0,0 +1,75 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/event"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+func TestLoadSessionLongLine(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", 1<<20)
+	b := NewBus(dir)
+	b.appendMsg(New("s1", "user", "hi"))
+	b.appendMsg(New("s1", "tool", long))
+
+	s := NewBus(dir).GetSession("s1")
+	if s == nil {
+		t.Fatal("session not loaded")
+	}
+	if len(s.Messages) != 2 || s.Messages[1].Text != long {
+		t.Fatalf("loaded %d messages, want 2 with the long tool result", len(s.Messages))
+	}
+}
+
+func TestReasoningItemsSurviveReload(t *testing.T) {
+	dir := t.TempDir()
+	item := json.RawMessage(`{"type":"reasoning","id":"rs_1","encrypted_content":"abc"}`)
+
+	events := make(chan event.Event, 3)
+	events <- event.Event{Type: event.Step, Data: event.StepData{Message: event.Message{
+		Role: "assistant", Content: "done", ReasoningItems: []json.RawMessage{item},
+	}}}
+	events <- event.Event{Type: event.Done, Data: event.DoneData{}}
+	close(events)
+	b := NewBus(dir)
+	b.GetOrCreateSession("s1")
+	for range b.HandleEvents("s1", events) {
+	}
+
+	s := NewBus(dir).GetSession("s1")
+	if s == nil {
+		t.Fatal("session not loaded")
+	}
+	history := ToLLM(s.Messages)
+	if len(history) != 1 || len(history[0].ReasoningItems) != 1 || !bytes.Equal(history[0].ReasoningItems[0], item) {
+		t.Fatalf("history after reload = %+v, want the reasoning item", history)
+	}
+}
+
+func TestUsageNoteSurvivesReload(t *testing.T) {
+	dir := t.TempDir()
+	b := NewBus(dir)
+	b.GetOrCreateSession("s1")
+	b.Pub(User("s1", "hi"))
+	b.Pub(UsageNote("s1", "[title] Greeting", types.Usage{Model: "small", Kind: "title", Input: 30, Output: 4}))
+
+	s := NewBus(dir).GetSession("s1")
+	if s == nil {
+		t.Fatal("session not loaded")
+	}
+	var usage []types.Usage
+	for _, m := range s.Messages {
+		usage = append(usage, m.Usage...)
+	}
+	if len(usage) != 1 || usage[0].Kind != "title" || usage[0].Input != 30 {
+		t.Fatalf("usage after reload = %+v, want the title call", usage)
+	}
+	if history := ToLLM(s.Messages); len(history) != 1 {
+		t.Fatalf("history = %+v, want only the user message", history)
+	}
+}
@@ -0,0 +1,192 @@
+package prompt
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/workspace"
+)
+
+// InstructionFiles are read from each directory in this order, so OTTER.md
+// can override the tool-agnostic AGENTS.md
+var InstructionFiles = []string{"AGENTS.md", "OTTER.md"}
+
+const (
+	maxInstructionBytes = 32 * 1024
+	maxIncludeDepth     = 5
+	maxScopedFiles      = 10
+	maxScopedDepth      = 3
+)
+
+type instruction struct {
+	path    string
+	scope   string // directory the file applies to, "" for everywhere
+	content string
+}
+
+// loadInstructions collects instruction files, lowest precedence first:
+// the global ones in config.Home(), then each directory from the git root
+// down to wd. Files in subdirectories of wd are returned as scoped.
+func loadInstructions(wd string) []instruction {
+	var out []instruction
+	seen := make(map[string]bool)
+	add := func(dir, scope string) {
+		for _, name := range InstructionFiles {
+			path := filepath.Join(dir, name)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			if content, ok := readInstruction(path); ok {
+				out = append(out, instruction{path: path, scope: scope, content: content})
+			}
+		}
+	}
+
+	add(config.Home(), "")
+	for _, dir := range dirsFromRoot(wd) {
+		add(dir, "")
+	}
+
+	scoped := 0
+	filepath.WalkDir(wd, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == wd {
+			return nil
+		}
+		rel, _ := filepath.Rel(wd, path)
+		if workspace.SkipDir(d.Name()) || strings.Count(rel, string(filepath.Separator)) >= maxScopedDepth {
+			return filepath.SkipDir
+		}
+		if scoped >= maxScopedFiles {
+			return filepath.SkipAll
+		}
+		before := len(out)
+		add(path, rel)
+		scoped += len(out) - before
+		return nil
+	})
+	return out
+}
+
+// dirsFromRoot lists the directories from the enclosing git root down to wd.
+// Outside a git repo only wd itself is used.
+func dirsFromRoot(wd string) []string {
+	dirs := []string{wd}
+	for dir := wd; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return []string{wd}
+		}
+		dir = parent
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
+
+func readInstruction(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	content, err := expandIncludes(path, map[string]bool{}, 0)
+	if err != nil {
+		return "", false
+	}
+	content = strings.TrimSpace(content)
+	return content, content != ""
+}
+
+// expandIncludes replaces "@include <path>" lines with the referenced file,
+// resolved relative to the including file. Cycles and overly deep nesting
+// are replaced by a note instead of failing the whole file.
+func expandIncludes(path string, stack map[string]bool, depth int) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxInstructionBytes {
+		data = append(data[:maxInstructionBytes], "\n[truncated]"...)
+	}
+	stack[abs] = true
+	defer delete(stack, abs)
+
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		target, ok := strings.CutPrefix(strings.TrimSpace(line), "@include ")
+		if !ok {
+			continue
+		}
+		target = strings.TrimSpace(target)
+		if rest, ok := strings.CutPrefix(target, "~/"); ok {
+			home, _ := os.UserHomeDir()
+			target = filepath.Join(home, rest)
+		} else if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(abs), target)
+		}
+		target = filepath.Clean(target)
+
+		switch {
+		case stack[target]:
+			lines[i] = fmt.Sprintf("[@include %s skipped: include cycle]", target)
+		case depth >= maxIncludeDepth:
+			lines[i] = fmt.Sprintf("[@include %s skipped: nested too deep]", target)
+		case !config.C.CheckReadPermission(target):
+			lines[i] = fmt.Sprintf("[@include %s skipped: permission denied]", target)
+		default:
+			included, err := expandIncludes(target, stack, depth+1)
+			if err != nil {
+				lines[i] = fmt.Sprintf("[@include %s not found]", target)
+				continue
+			}
+			lines[i] = strings.TrimRight(included, "\n")
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func instructionsSection(wd string) string {
+	if wd == "" {
+		return ""
+	}
+	files := loadInstructions(wd)
+	if len(files) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n## Project Instructions\n\nFollow these instructions from the user and the project. When they conflict, later sections override earlier ones, and scoped sections apply only to files in their directory.\n")
+	for _, f := range files {
+		path := f.path
+		if rel, err := filepath.Rel(wd, f.path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		if f.scope != "" {
+			fmt.Fprintf(&sb, "\n### %s (applies only to %s/)\n\n%s\n", path, filepath.ToSlash(f.scope), f.content)
+		} else {
+			fmt.Fprintf(&sb, "\n### %s\n\n%s\n", path, f.content)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// InitPrompt asks the agent to explore the repository and write an AGENTS.md
+const InitPrompt = `Explore this repository and create an AGENTS.md file in the current directory that gives future coding sessions the context they need. If AGENTS.md already exists, read it and improve it instead of starting over.
+
+Investigate before writing:
+- Build, lint and test commands (including how to run a single test), from the Makefile, package manifests, CI config and README
+- Code style and conventions actually used: naming, error handling, logging, comment language, test layout
+- High-level architecture: main packages or modules and how they fit together
+- Directories or files that must not be edited (generated code, vendored deps) and anything else surprising
+
+Keep it concise (well under 150 lines), specific to this repo, and skip generic advice. Write the file with the file tool, then reply with a short summary of what you included.`
@@ -7,11 +7,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/mode"
+	"github.com/abcdlsj/otter/internal/repomap"
 	"github.com/abcdlsj/otter/internal/tool"
 )
 
 // Load returns the system prompt for given mode
-func Load(tools *tool.Set, maxSteps int, mode string) string {
+func Load(tools *tool.Set, m mode.Mode) string {
 	wd, _ := os.Getwd()
 	date := time.Now().Format("2006-01-02")
 	
@@ -20,13 +23,28 @@ func Load(tools *tool.Set, maxSteps int, mode string) string {
 		fmt.Fprintf(&toolList, "- **%s**: %s\n", t.Name(), t.Desc())
 	}
 
-	if mode == "plan" {
-		return fmt.Sprintf(planPrompt, wd, runtime.GOOS, date, toolList.String())
+	instructions := instructionsSection(wd)
+	if !m.Builtin() {
+		return fmt.Sprintf(customPrompt, m.Prompt, wd, runtime.GOOS, date, toolList.String()) + instructions
 	}
-	if mode == "explore" {
-		return fmt.Sprintf(explorePrompt, wd, runtime.GOOS, date, toolList.String())
+	if m.Name == "plan" {
+		return fmt.Sprintf(planPrompt, wd, runtime.GOOS, date, toolList.String()) + instructions
 	}
-	return fmt.Sprintf(defaultPrompt, wd, runtime.GOOS, date, toolList.String(), maxSteps)
+	if m.Name == "explore" {
+		return fmt.Sprintf(explorePrompt, wd, runtime.GOOS, date, toolList.String()) + instructions
+	}
+	return fmt.Sprintf(defaultPrompt, wd, runtime.GOOS, date, repoMapSection(wd), toolList.String()) + instructions
+}
+
+func repoMapSection(wd string) string {
+	if !config.C.RepoMap.Enabled || wd == "" {
+		return ""
+	}
+	outline := repomap.Build(wd, config.C.RepoMap.Tokens)
+	if outline == "" {
+		return ""
+	}
+	return "\n\n## Repository Map\n\nMost referenced files and their top-level symbols (line: signature). Use it to go straight to the right file instead of listing directories.\n\n```\n" + outline + "\n```"
 }
 
 const defaultPrompt = `You are an AI coding assistant running in a terminal. You help users write, debug, and understand code by using tools to explore and modify their codebase.
@@ -35,7 +53,7 @@ const defaultPrompt = `You are an AI coding assistant running in a terminal. You
 
 - Working directory: %s
 - OS: %s
-- Date: %s
+- Date: %s%s
 
 ## Available Tools
 
@@ -59,6 +77,7 @@ IMPORTANT: Minimize the number of tool calls. Each tool call is a round-trip —
 - **Avoid redundant exploration**: Don't list files just to find files, then read files. Use file search with patterns to go directly to what you need.
 - Use file search (pattern/grep) to locate code before reading entire files.
 - When modifying files, read the current content first to avoid stale edits.
+- For several changes to one file use multiedit; for related changes across files use patch with a unified diff. Both apply all changes or none.
 - For shell commands: prefer non-destructive commands; confirm before running anything risky.
 
 ## Response Style
@@ -115,3 +134,16 @@ const explorePrompt = `You are a code exploration assistant. Help users quickly
 - Provide concise summaries of what you find.
 - Reference exact file paths and line numbers.
 - Don't over-explain — just show the relevant code.`
+
+// customPrompt wraps the body of a user-defined mode
+const customPrompt = `%s
+
+## Environment
+
+- Working directory: %s
+- OS: %s
+- Date: %s
+
+## Available Tools
+
+%s`
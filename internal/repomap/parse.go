@@ -0,0 +1,250 @@
+package repomap
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Symbol is a top-level declaration
+type Symbol struct {
+	Name string `json:"name"`
+	Line int    `json:"line"`
+	Sig  string `json:"sig"`
+}
+
+// parseFile extracts declarations and the identifiers a file uses. For Go
+// the package name is returned too and refs distinguish plain identifiers
+// ("Name"), qualified ones ("pkg.Name") and selectors (".Name").
+func parseFile(path string, src []byte) (pkg string, syms []Symbol, refs []string) {
+	if filepath.Ext(path) == ".go" {
+		if pkg, syms, refs, ok := parseGo(path, src); ok {
+			return pkg, syms, refs
+		}
+	}
+	syms, refs = parseHeuristic(path, src)
+	return "", syms, refs
+}
+
+func parseGo(path string, src []byte) (string, []Symbol, []string, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil, nil, false
+	}
+
+	var syms []Symbol
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = recvType(d.Recv.List[0].Type) + "." + name
+			}
+			syms = append(syms, Symbol{Name: name, Line: fset.Position(d.Pos()).Line, Sig: funcSig(fset, d)})
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					syms = append(syms, Symbol{
+						Name: s.Name.Name,
+						Line: fset.Position(s.Pos()).Line,
+						Sig:  "type " + s.Name.Name + " " + typeKind(s.Type),
+					})
+				case *ast.ValueSpec:
+					if d.Tok != token.CONST && d.Tok != token.VAR {
+						continue
+					}
+					for _, n := range s.Names {
+						// Unexported package-level values rarely help orientation
+						if !n.IsExported() {
+							continue
+						}
+						syms = append(syms, Symbol{Name: n.Name, Line: fset.Position(n.Pos()).Line, Sig: d.Tok.String() + " " + n.Name})
+					}
+				}
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			if id, ok := x.X.(*ast.Ident); ok {
+				seen[id.Name+"."+x.Sel.Name] = true
+				seen[id.Name] = true
+			} else {
+				ast.Inspect(x.X, visit)
+			}
+			seen["."+x.Sel.Name] = true
+			return false
+		case *ast.Ident:
+			seen[x.Name] = true
+		}
+		return true
+	}
+	ast.Inspect(f, visit)
+	return f.Name.Name, syms, sortedKeys(seen), true
+}
+
+func recvType(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.StarExpr:
+		return recvType(t.X)
+	case *ast.IndexExpr:
+		return recvType(t.X)
+	case *ast.IndexListExpr:
+		return recvType(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
+
+func funcSig(fset *token.FileSet, d *ast.FuncDecl) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, &ast.FuncDecl{Recv: d.Recv, Name: d.Name, Type: d.Type})
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func typeKind(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	case *ast.FuncType:
+		return "func"
+	case *ast.MapType:
+		return "map"
+	case *ast.ArrayType:
+		return "slice"
+	case *ast.ChanType:
+		return "chan"
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok {
+			return x.Name + "." + t.Sel.Name
+		}
+	}
+	return ""
+}
+
+// Declaration patterns for languages without a parser here. Group 1 is the
+// name; the whole trimmed line becomes the signature.
+var heuristics = map[string][]*regexp.Regexp{
+	".py": {
+		regexp.MustCompile(`^(?:async\s+)?def\s+(\w+)`),
+		regexp.MustCompile(`^class\s+(\w+)`),
+	},
+	".js":  jsPatterns,
+	".jsx": jsPatterns,
+	".ts":  jsPatterns,
+	".tsx": jsPatterns,
+	".rs": {
+		regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?fn\s+(\w+)`),
+		regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|type|mod)\s+(\w+)`),
+	},
+	".java": classPatterns,
+	".kt":   classPatterns,
+	".cs":   classPatterns,
+	".c":    cPatterns,
+	".h":    cPatterns,
+	".cc":   cPatterns,
+	".cpp":  cPatterns,
+	".hpp":  cPatterns,
+	".rb": {
+		regexp.MustCompile(`^\s*def\s+(?:self\.)?(\w+[?!]?)`),
+		regexp.MustCompile(`^\s*(?:class|module)\s+(\w+)`),
+	},
+}
+
+var jsPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+(\w+)`),
+	regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`),
+	regexp.MustCompile(`^(?:export\s+)?(?:interface|type|enum)\s+(\w+)`),
+	regexp.MustCompile(`^export\s+(?:const|let|var)\s+(\w+)`),
+}
+
+var classPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|abstract|final|static|sealed|data|open)\s+)*(?:class|interface|enum|record|object)\s+(\w+)`),
+	regexp.MustCompile(`^\s*(?:(?:public|protected|internal|static|final|abstract|override|suspend)\s+)+[\w<>\[\],\s]*?\b(\w+)\s*\(`),
+	regexp.MustCompile(`^\s*fun\s+(?:<[^>]*>\s*)?(?:\w+\.)?(\w+)\s*\(`),
+}
+
+var cPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:typedef\s+)?(?:struct|enum|union|class)\s+(\w+)\s*\{?`),
+	regexp.MustCompile(`^[A-Za-z_][\w\s\*&:<>,]*?\b(\w+)\s*\([^;]*$`),
+}
+
+var wordRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+func parseHeuristic(path string, src []byte) ([]Symbol, []string) {
+	patterns := heuristics[strings.ToLower(filepath.Ext(path))]
+	if patterns == nil {
+		return nil, nil
+	}
+
+	var syms []Symbol
+	for i, line := range strings.Split(string(src), "\n") {
+		for _, re := range patterns {
+			m := re.FindStringSubmatch(line)
+			if m == nil || isKeyword(m[1]) {
+				continue
+			}
+			sig := strings.TrimSpace(line)
+			sig = strings.TrimRight(sig, "{:")
+			if r := []rune(sig); len(r) > 120 {
+				sig = string(r[:120]) + "…"
+			}
+			syms = append(syms, Symbol{Name: m[1], Line: i + 1, Sig: strings.TrimSpace(sig)})
+			break
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, w := range wordRe.FindAll(src, -1) {
+		seen[string(w)] = true
+	}
+	return syms, sortedKeys(seen)
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "if", "for", "while", "switch", "return", "catch", "sizeof", "new", "else":
+		return true
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// baseName is the part of a symbol other files refer to: "Agent.Run" -> "Run"
+func baseName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func exported(name string) bool {
+	r := []rune(baseName(name))
+	return len(r) > 0 && unicode.IsUpper(r[0])
+}
@@ -0,0 +1,287 @@
+package repomap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/workspace"
+)
+
+const (
+	cacheVersion      = 2
+	maxFiles          = 5000
+	maxFileSize       = 512 * 1024
+	maxSymbolsPerFile = 10
+	charsPerToken     = 4
+)
+
+type entry struct {
+	Pkg     string   `json:"pkg,omitempty"` // Go package name
+	ModTime int64    `json:"mtime"`
+	Size    int64    `json:"size"`
+	Symbols []Symbol `json:"symbols,omitempty"`
+	Refs    []string `json:"refs,omitempty"`
+}
+
+type cacheFile struct {
+	Version int               `json:"version"`
+	Files   map[string]*entry `json:"files"`
+}
+
+var (
+	mu      sync.Mutex
+	entries map[string]*entry // rel path -> parsed file, shared across turns
+	built   map[string]string // root and budget -> outline, until Invalidate
+)
+
+// Build returns an outline of the most referenced files and symbols under
+// root, at most tokens long. Parsed files are cached on disk and only
+// re-parsed when their mtime or size changes; the outline itself is reused
+// until Invalidate.
+func Build(root string, tokens int) string {
+	if tokens <= 0 {
+		return ""
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := fmt.Sprintf("%s:%d", root, tokens)
+	if out, ok := built[key]; ok {
+		return out
+	}
+	if entries == nil {
+		entries = loadCache()
+	}
+	if refresh(root, entries) {
+		saveCache(entries)
+	}
+	out := render(rank(entries), tokens*charsPerToken)
+	if built == nil {
+		built = make(map[string]string)
+	}
+	built[key] = out
+	return out
+}
+
+// Invalidate makes the next Build rescan the workspace. Call it when files
+// may have changed: at the start of a turn and after a write.
+func Invalidate() {
+	mu.Lock()
+	clear(built)
+	mu.Unlock()
+}
+
+// refresh re-parses changed files and drops deleted ones, reporting whether anything changed
+func refresh(root string, files map[string]*entry) bool {
+	paths := listFiles(root)
+	changed := false
+	live := make(map[string]bool, len(paths))
+	for _, rel := range paths {
+		live[rel] = true
+		abs := filepath.Join(root, rel)
+		info, err := os.Stat(abs)
+		if err != nil || info.IsDir() || info.Size() > maxFileSize {
+			continue
+		}
+		if e, ok := files[rel]; ok && e.ModTime == info.ModTime().UnixNano() && e.Size == info.Size() {
+			continue
+		}
+		src, err := os.ReadFile(abs)
+		if err != nil {
+			continue
+		}
+		pkg, syms, refs := parseFile(abs, src)
+		files[rel] = &entry{Pkg: pkg, ModTime: info.ModTime().UnixNano(), Size: info.Size(), Symbols: syms, Refs: refs}
+		changed = true
+	}
+	for rel := range files {
+		if !live[rel] {
+			delete(files, rel)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// listFiles returns source files relative to root, honouring .gitignore when root is in a git repo
+func listFiles(root string) []string {
+	return workspace.Files(root, maxFiles, parseable)
+}
+
+func parseable(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".go" && heuristics[ext] == nil {
+		return false
+	}
+	return config.C.CheckReadPermission(path)
+}
+
+type rankedFile struct {
+	path    string
+	score   float64
+	symbols []rankedSymbol
+}
+
+type rankedSymbol struct {
+	Symbol
+	score float64
+}
+
+// rank scores each symbol by how many other files reference it, with names
+// defined in many places counting for less, and files by the sum of their
+// symbols. Go symbols are matched by package: plain names within the same
+// directory, pkg.Name elsewhere, and methods (weakly) by selector name.
+func rank(files map[string]*entry) []rankedFile {
+	defs := make(map[string][]string) // ref key -> files defining it
+	addDef := func(key, path string) {
+		if !slices.Contains(defs[key], path) {
+			defs[key] = append(defs[key], path)
+		}
+	}
+	for path, e := range files {
+		for _, s := range e.Symbols {
+			for _, key := range defKeys(path, e, s) {
+				addDef(key, path)
+			}
+		}
+	}
+
+	refScore := make(map[string]map[string]float64) // file -> ref key -> score
+	for path, e := range files {
+		for _, ref := range e.Refs {
+			if e.Pkg != "" && !strings.Contains(ref, ".") {
+				ref = filepath.Dir(path) + "|" + ref
+			}
+			owners := defs[ref]
+			for _, owner := range owners {
+				if owner == path {
+					continue
+				}
+				if refScore[owner] == nil {
+					refScore[owner] = make(map[string]float64)
+				}
+				refScore[owner][ref] += 1 / float64(len(owners))
+			}
+		}
+	}
+
+	var ranked []rankedFile
+	for path, e := range files {
+		if len(e.Symbols) == 0 {
+			continue
+		}
+		rf := rankedFile{path: path}
+		for _, s := range e.Symbols {
+			var score float64
+			for _, key := range defKeys(path, e, s) {
+				w := 1.0
+				if strings.HasPrefix(key, ".") {
+					w = 0.25 // x.Method could be any type's method
+				}
+				score += w * refScore[path][key]
+			}
+			if exported(s.Name) {
+				score += 0.1
+			}
+			rf.symbols = append(rf.symbols, rankedSymbol{Symbol: s, score: score})
+			rf.score += score
+		}
+		ranked = append(ranked, rf)
+	}
+	slices.SortFunc(ranked, func(a, b rankedFile) int {
+		if a.score != b.score {
+			if a.score > b.score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.path, b.path)
+	})
+	return ranked
+}
+
+// defKeys lists the reference keys that point at s
+func defKeys(path string, e *entry, s Symbol) []string {
+	if e.Pkg == "" {
+		return []string{s.Name}
+	}
+	if strings.Contains(s.Name, ".") {
+		return []string{"." + baseName(s.Name)}
+	}
+	return []string{filepath.Dir(path) + "|" + s.Name, e.Pkg + "." + s.Name}
+}
+
+func render(files []rankedFile, budget int) string {
+	var sb strings.Builder
+	for i, f := range files {
+		syms := slices.Clone(f.symbols)
+		slices.SortStableFunc(syms, func(a, b rankedSymbol) int {
+			switch {
+			case a.score > b.score:
+				return -1
+			case a.score < b.score:
+				return 1
+			}
+			return a.Line - b.Line
+		})
+		syms = syms[:min(len(syms), maxSymbolsPerFile)]
+		slices.SortFunc(syms, func(a, b rankedSymbol) int { return a.Line - b.Line })
+
+		var block strings.Builder
+		block.WriteString(filepath.ToSlash(f.path) + "\n")
+		for _, s := range syms {
+			fmt.Fprintf(&block, "  %d: %s\n", s.Line, s.Sig)
+		}
+		if hidden := len(f.symbols) - len(syms); hidden > 0 {
+			fmt.Fprintf(&block, "  ... %d more\n", hidden)
+		}
+
+		if sb.Len()+block.Len() > budget {
+			if rest := len(files) - i; rest > 0 && sb.Len() > 0 {
+				fmt.Fprintf(&sb, "(%d more files)\n", rest)
+			}
+			break
+		}
+		sb.WriteString(block.String())
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func cachePath() string {
+	return filepath.Join(config.Home(), "repomap", config.WorkDirName()+".json")
+}
+
+func loadCache() map[string]*entry {
+	data, err := os.ReadFile(cachePath())
+	if err != nil {
+		return make(map[string]*entry)
+	}
+	var c cacheFile
+	if err := json.Unmarshal(data, &c); err != nil || c.Version != cacheVersion || c.Files == nil {
+		return make(map[string]*entry)
+	}
+	return c.Files
+}
+
+func saveCache(files map[string]*entry) {
+	path := cachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logger.Warn("repomap cache dir", "err", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(cacheFile{Version: cacheVersion, Files: files}); err != nil {
+		return
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		logger.Warn("repomap cache write", "err", err)
+	}
+}
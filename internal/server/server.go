@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/agent"
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/msg"
+	"github.com/abcdlsj/otter/internal/tool"
+)
+
+// Server exposes sessions over a local HTTP API so editors, web UIs and
+// other terminals can drive or watch the agent
+type Server struct {
+	llm   *llm.LLM
+	tools *tool.Set
+	bus   *msg.Bus
+	token string
+
+	mu   sync.Mutex
+	runs map[string]*run // by session
+}
+
+// run is a turn in progress
+type run struct {
+	cancel context.CancelFunc
+	queue  *agent.Queue
+}
+
+func New(l *llm.LLM, tools *tool.Set, bus *msg.Bus, token string) *Server {
+	return &Server{
+		llm:   l,
+		tools: tools,
+		bus:   bus,
+		token: token,
+		runs:  make(map[string]*run),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", s.listSessions)
+	mux.HandleFunc("POST /sessions", s.createSession)
+	mux.HandleFunc("GET /sessions/{id}", s.getSession)
+	mux.HandleFunc("DELETE /sessions/{id}", s.deleteSession)
+	mux.HandleFunc("POST /sessions/{id}/fork", s.forkSession)
+	mux.HandleFunc("POST /sessions/{id}/messages", s.postMessage)
+	mux.HandleFunc("POST /sessions/{id}/cancel", s.cancelRun)
+	mux.HandleFunc("GET /sessions/{id}/events", s.streamEvents)
+	return s.auth(mux)
+}
+
+// auth accepts the token as a bearer token, or as ?token= for clients such
+// as EventSource that can't set headers
+func (s *Server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type sessionInfo struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Messages    int       `json:"messages"`
+	Running     bool      `json:"running"`
+	Interrupted bool      `json:"interrupted"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s *Server) info(sess *msg.Session) sessionInfo {
+	return sessionInfo{
+		ID:          sess.ID,
+		Title:       sess.Title,
+		Messages:    len(sess.Messages),
+		Running:     s.running(sess.ID),
+		Interrupted: sess.Interrupted(),
+		CreatedAt:   sess.CreatedAt,
+		UpdatedAt:   sess.UpdatedAt,
+	}
+}
+
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	list := []sessionInfo{}
+	for _, sess := range s.bus.ListSessions() {
+		list = append(list, s.info(sess))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	sess := s.bus.GetOrCreateSession(msg.NewSessionID())
+	writeJSON(w, http.StatusCreated, s.info(sess))
+}
+
+func (s *Server) getSession(w http.ResponseWriter, r *http.Request) {
+	sess := s.bus.GetSession(r.PathValue("id"))
+	if sess == nil {
+		writeError(w, http.StatusNotFound, errors.New("session not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		sessionInfo
+		Messages []msg.Msg `json:"messages"`
+	}{s.info(sess), sess.Messages})
+}
+
+func (s *Server) deleteSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.bus.GetSession(id) == nil {
+		writeError(w, http.StatusNotFound, errors.New("session not found"))
+		return
+	}
+	if s.running(id) {
+		writeError(w, http.StatusConflict, errors.New("session is running, cancel it first"))
+		return
+	}
+	s.bus.DeleteSession(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) forkSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		At string `json:"at"` // last message to keep; all when empty
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	sess, err := s.bus.Fork(r.PathValue("id"), req.At)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.info(sess))
+}
+
+// postMessage starts a turn with the message. While a turn is running the
+// message is queued and added between its steps, as in the TUI. An empty
+// text resumes an interrupted turn.
+func (s *Server) postMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text     string `json:"text"`
+		MaxSteps int    `json:"max_steps"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	id := r.PathValue("id")
+	sess := s.bus.GetSession(id)
+	if sess == nil {
+		writeError(w, http.StatusNotFound, errors.New("session not found"))
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" && !sess.Interrupted() {
+		writeError(w, http.StatusBadRequest, errors.New("text is required unless the last turn was interrupted"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.runs[id]; ok {
+		if req.Text == "" {
+			writeError(w, http.StatusConflict, errors.New("session is already running"))
+			return
+		}
+		cur.queue.Push(req.Text)
+		writeJSON(w, http.StatusAccepted, map[string]any{"status": "queued", "queued": cur.queue.Len()})
+		return
+	}
+	s.start(sess, req.Text, req.MaxSteps)
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "started"})
+}
+
+// start runs a turn in the background. The caller holds s.mu.
+func (s *Server) start(sess *msg.Session, text string, steps int) {
+	id := sess.ID
+	first := len(sess.Messages) == 0
+	history := msg.ToLLM(sess.Messages)
+	if text != "" {
+		s.bus.Pub(msg.User(id, text))
+	}
+
+	lg := logger.NewFileLogger(logger.SessionLogDir(config.SessionsDir(), id))
+	// Agents keep per-run state, so each run gets its own
+	ag := agent.New(s.llm, s.tools)
+	ctx, cancel := context.WithCancel(context.Background())
+	cur := &run{cancel: cancel, queue: agent.NewQueue()}
+	s.runs[id] = cur
+
+	events := s.bus.HandleEvents(id, ag.Run(ctx, lg, history, text, nil, agent.Options{Queue: cur.queue, MaxSteps: steps}))
+	go func() {
+		for range events {
+		}
+		cancel()
+		s.mu.Lock()
+		delete(s.runs, id)
+		// Messages queued after the agent's last check start the next turn
+		if queued := cur.queue.Drain(); len(queued) > 0 {
+			if sess := s.bus.GetSession(id); sess != nil {
+				s.start(sess, strings.Join(queued, "\n\n"), 0)
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	if first && text != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			defer cancel()
+			title, usage, err := ag.GenerateTitle(ctx, lg, text)
+			if err != nil {
+				lg.Warn("generate title failed", "err", err)
+				return
+			}
+			if title != "" {
+				s.bus.SetSessionTitle(id, title)
+			}
+			s.bus.Pub(msg.UsageNote(id, "[title] "+title, usage))
+		}()
+	}
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	cur, ok := s.runs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusConflict, errors.New("session is not running"))
+		return
+	}
+	cur.queue.Drain()
+	cur.cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) running(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.runs[id]
+	return ok
+}
+
+// streamEvents sends the session's agent events as server-sent events, one
+// JSON-encoded event.Event per message, until the client goes away
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.bus.GetSession(id) == nil {
+		writeError(w, http.StatusNotFound, errors.New("session not found"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+
+	ch := s.bus.SubEvent(id)
+	defer s.bus.UnsubEvent(id, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/config"
+)
+
+// TokenPath is where the server keeps its access token. Only the user can
+// read it, which is what makes it a local credential.
+func TokenPath() string {
+	return filepath.Join(config.Home(), "server.token")
+}
+
+// Token reads the access token, creating one on first use
+func Token() (string, error) {
+	path := TokenPath()
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,110 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/diff"
+)
+
+// fileChange is a pending write computed in memory before anything touches disk
+type fileChange struct {
+	path    string
+	old     string
+	new     string
+	mode    os.FileMode
+	existed bool
+	remove  bool
+}
+
+func (c *fileChange) diff() diff.File {
+	return diff.Compute(c.path, c.old, c.new)
+}
+
+// checkWrite returns the permission error for writing path, if any
+func checkWrite(path string) error {
+	cfg := &config.C
+	if cfg.CheckWritePermission(path) {
+		return nil
+	}
+	if cfg.Security.Readonly {
+		return fmt.Errorf("permission denied: readonly mode is enabled")
+	}
+	return fmt.Errorf("permission denied: cannot write to %s", path)
+}
+
+// loadChange reads path into a pending change. Missing files load as empty
+// when allowMissing is set so they can be created.
+func loadChange(ctx context.Context, path string, allowMissing bool) (*fileChange, error) {
+	if err := checkWrite(path); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) && allowMissing {
+			return &fileChange{path: path, mode: 0644}, nil
+		}
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file not found: %s", path)
+		}
+		return nil, fmt.Errorf("cannot access file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("path is a directory, not a file: %s", path)
+	}
+	content, err := FSFrom(ctx).ReadFile(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return &fileChange{path: path, old: string(content), new: string(content), mode: info.Mode(), existed: true}, nil
+}
+
+// applyChanges writes every change or none: if a write fails, the files
+// already written are restored to their previous content.
+func applyChanges(ctx context.Context, changes []*fileChange) error {
+	var done []*fileChange
+	for _, c := range changes {
+		if err := writeChange(ctx, c); err != nil {
+			for _, d := range done {
+				restoreChange(ctx, d)
+			}
+			return fmt.Errorf("failed to write %s: %w (all changes rolled back)", c.path, err)
+		}
+		done = append(done, c)
+	}
+	return nil
+}
+
+func writeChange(ctx context.Context, c *fileChange) error {
+	if c.remove {
+		return os.Remove(c.path)
+	}
+	if !c.existed {
+		if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+			return err
+		}
+	}
+	return FSFrom(ctx).WriteFile(ctx, c.path, []byte(c.new), c.mode)
+}
+
+func restoreChange(ctx context.Context, c *fileChange) {
+	if !c.existed {
+		os.Remove(c.path)
+		return
+	}
+	FSFrom(ctx).WriteFile(ctx, c.path, []byte(c.old), c.mode)
+}
+
+// changeDiffs returns the non-empty diffs of changes, in order
+func changeDiffs(changes []*fileChange) []diff.File {
+	var files []diff.File
+	for _, c := range changes {
+		if d := c.diff(); !d.Empty() {
+			files = append(files, d)
+		}
+	}
+	return files
+}
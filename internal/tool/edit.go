@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/diff"
 )
 
 // Edit 工具用于精确编辑文件内容，通过查找并替换特定文本
@@ -16,7 +17,7 @@ type Edit struct{}
 
 func (Edit) Name() string { return "edit" }
 func (Edit) Desc() string {
-	return "Edit a file by replacing exact text. The oldText must match exactly (including whitespace). Use this for precise, surgical edits."
+	return "Edit a file by replacing text. oldText should match exactly; if it doesn't, a unique match ignoring trailing whitespace, indentation, or small differences is used. Use this for precise, surgical edits."
 }
 func (Edit) Args() map[string]any {
 	return map[string]any{
@@ -28,7 +29,7 @@ func (Edit) Args() map[string]any {
 			},
 			"oldText": map[string]any{
 				"type":        "string",
-				"description": "Exact text to find and replace (must match exactly including whitespace)",
+				"description": "Text to find and replace, copied exactly from the file including whitespace",
 			},
 			"newText": map[string]any{
 				"type":        "string",
@@ -40,20 +41,25 @@ func (Edit) Args() map[string]any {
 }
 
 func (e Edit) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	r, err := e.RunResult(ctx, raw)
+	return r.Output, err
+}
+
+func (e Edit) RunResult(ctx context.Context, raw json.RawMessage) (Result, error) {
 	var args struct {
 		Path    string `json:"path"`
 		OldText string `json:"oldText"`
 		NewText string `json:"newText"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
-		return "", fmt.Errorf("failed to parse arguments: %w", err)
+		return Result{}, fmt.Errorf("failed to parse arguments: %w", err)
 	}
 
 	if args.Path == "" {
-		return "", fmt.Errorf("path is required")
+		return Result{}, fmt.Errorf("path is required")
 	}
 	if args.OldText == "" {
-		return "", fmt.Errorf("oldText is required")
+		return Result{}, fmt.Errorf("oldText is required")
 	}
 
 	// Clean the path
@@ -63,52 +69,44 @@ func (e Edit) Run(ctx context.Context, raw json.RawMessage) (string, error) {
 	cfg := &config.C
 	if !cfg.CheckWritePermission(args.Path) {
 		if cfg.Security.Readonly {
-			return "", fmt.Errorf("permission denied: readonly mode is enabled")
+			return Result{}, fmt.Errorf("permission denied: readonly mode is enabled")
 		}
-		return "", fmt.Errorf("permission denied: cannot write to %s", args.Path)
+		return Result{}, fmt.Errorf("permission denied: cannot write to %s", args.Path)
 	}
 
 	// Check if file exists
 	info, err := os.Stat(args.Path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", fmt.Errorf("file not found: %s", args.Path)
+			return Result{}, fmt.Errorf("file not found: %s", args.Path)
 		}
-		return "", fmt.Errorf("cannot access file: %w", err)
+		return Result{}, fmt.Errorf("cannot access file: %w", err)
 	}
 
 	if info.IsDir() {
-		return "", fmt.Errorf("path is a directory, not a file: %s", args.Path)
+		return Result{}, fmt.Errorf("path is a directory, not a file: %s", args.Path)
 	}
 
 	// Read file content
-	content, err := os.ReadFile(args.Path)
+	content, err := FSFrom(ctx).ReadFile(ctx, args.Path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+		return Result{}, fmt.Errorf("failed to read file: %w", err)
 	}
 
 	oldContent := string(content)
 
-	// Check if oldText exists in the file
-	if !strings.Contains(oldContent, args.OldText) {
-		// Provide helpful context about what was found
-		const contextLen = 100
-		preview := oldContent
-		if len(preview) > contextLen {
-			preview = preview[:contextLen] + "..."
-		}
-		preview = strings.ReplaceAll(preview, "\n", "\\n")
-		return "", fmt.Errorf("oldText not found in file. The text must match exactly (including whitespace and indentation). File starts with: %s", preview)
+	// Locate oldText, falling back to whitespace-tolerant and fuzzy matching
+	m, err := findMatch(oldContent, args.OldText)
+	if err != nil {
+		return Result{}, err
 	}
-
-	// Count occurrences
-	occurrences := strings.Count(oldContent, args.OldText)
-	if occurrences > 1 {
-		return "", fmt.Errorf("oldText appears %d times in the file. Please provide more context to make it unique", occurrences)
+	newText := args.NewText
+	if m.strategy != "exact" {
+		newText = reindent(newText, m.indents)
 	}
 
 	// Perform the replacement
-	newContent := strings.Replace(oldContent, args.OldText, args.NewText, 1)
+	newContent := oldContent[:m.start] + newText + oldContent[m.end:]
 
 	// Check for destructive changes
 	if cfg.Security.ConfirmDestructive {
@@ -117,17 +115,20 @@ func (e Edit) Run(ctx context.Context, raw json.RawMessage) (string, error) {
 	}
 
 	// Write the modified content back
-	if err := os.WriteFile(args.Path, []byte(newContent), info.Mode()); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	if err := FSFrom(ctx).WriteFile(ctx, args.Path, []byte(newContent), info.Mode()); err != nil {
+		return Result{}, fmt.Errorf("failed to write file: %w", err)
 	}
 
 	// Calculate line numbers for the report
-	linesBefore := strings.Count(oldContent[:strings.Index(oldContent, args.OldText)], "\n") + 1
-	oldLines := strings.Count(args.OldText, "\n")
-	newLines := strings.Count(args.NewText, "\n")
+	linesBefore := strings.Count(oldContent[:m.start], "\n") + 1
+	oldLines := strings.Count(oldContent[m.start:m.end], "\n")
+	newLines := strings.Count(newText, "\n")
 
 	result := fmt.Sprintf("✓ Edited %s\n", args.Path)
 	result += fmt.Sprintf("  Replaced %d line(s) at line %d with %d line(s)", oldLines+1, linesBefore, newLines+1)
+	if m.strategy != "exact" {
+		result += fmt.Sprintf(" (matched %s)", m.strategy)
+	}
 
-	return result, nil
+	return Result{Output: result, Diffs: []diff.File{diff.Compute(args.Path, oldContent, newContent)}}, nil
 }
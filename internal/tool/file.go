@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/diff"
 )
 
 const (
@@ -56,6 +57,11 @@ func (File) Args() map[string]any {
 }
 
 func (f File) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	r, err := f.RunResult(ctx, raw)
+	return r.Output, err
+}
+
+func (f File) RunResult(ctx context.Context, raw json.RawMessage) (Result, error) {
 	var args struct {
 		Action  string `json:"action"`
 		Path    string `json:"path"`
@@ -65,7 +71,7 @@ func (f File) Run(ctx context.Context, raw json.RawMessage) (string, error) {
 		Limit   int    `json:"limit"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
-		return "", err
+		return Result{}, err
 	}
 
 	// Clean the path
@@ -76,40 +82,42 @@ func (f File) Run(ctx context.Context, raw json.RawMessage) (string, error) {
 	switch args.Action {
 	case "read", "list", "search":
 		if !cfg.CheckReadPermission(args.Path) {
-			return "", fmt.Errorf("permission denied: cannot read %s", args.Path)
+			return Result{}, fmt.Errorf("permission denied: cannot read %s", args.Path)
 		}
 	case "write":
 		if !cfg.CheckWritePermission(args.Path) {
 			if cfg.Security.Readonly {
-				return "", fmt.Errorf("permission denied: readonly mode is enabled")
+				return Result{}, fmt.Errorf("permission denied: readonly mode is enabled")
 			}
-			return "", fmt.Errorf("permission denied: cannot write to %s", args.Path)
+			return Result{}, fmt.Errorf("permission denied: cannot write to %s", args.Path)
 		}
 	}
 
 	switch args.Action {
 	case "read":
-		return readFile(args.Path, args.Offset, args.Limit)
+		out, err := readFile(ctx, args.Path, args.Offset, args.Limit)
+		return Result{Output: out}, err
 
 	case "write":
 		// Additional safety: check if file exists (overwrite protection)
 		if cfg.Security.ConfirmDestructive {
 			if _, err := os.Stat(args.Path); err == nil {
-				return "", fmt.Errorf("confirmation required: file %s already exists. Set confirm_destructive=false to allow overwrites", args.Path)
+				return Result{}, fmt.Errorf("confirmation required: file %s already exists. Set confirm_destructive=false to allow overwrites", args.Path)
 			}
 		}
+		old, _ := FSFrom(ctx).ReadFile(ctx, args.Path)
 		if err := os.MkdirAll(filepath.Dir(args.Path), 0755); err != nil {
-			return "", err
+			return Result{}, err
 		}
-		if err := os.WriteFile(args.Path, []byte(args.Content), 0644); err != nil {
-			return "", err
+		if err := FSFrom(ctx).WriteFile(ctx, args.Path, []byte(args.Content), 0644); err != nil {
+			return Result{}, err
 		}
-		return "ok", nil
+		return Result{Output: "ok", Diffs: []diff.File{diff.Compute(args.Path, string(old), args.Content)}}, nil
 
 	case "list":
 		entries, err := os.ReadDir(args.Path)
 		if err != nil {
-			return "", err
+			return Result{}, err
 		}
 		var sb strings.Builder
 		for _, e := range entries {
@@ -121,11 +129,11 @@ func (f File) Run(ctx context.Context, raw json.RawMessage) (string, error) {
 			sb.WriteString(e.Name())
 			sb.WriteString("\n")
 		}
-		return sb.String(), nil
+		return Result{Output: sb.String()}, nil
 
 	case "search":
 		if args.Pattern == "" {
-			return "", fmt.Errorf("pattern is required for search")
+			return Result{}, fmt.Errorf("pattern is required for search")
 		}
 		name, grepArgs := "rg", []string{"-n", "--no-heading", args.Pattern, args.Path}
 		if _, err := exec.LookPath("rg"); err != nil {
@@ -134,28 +142,27 @@ func (f File) Run(ctx context.Context, raw json.RawMessage) (string, error) {
 		out, err := exec.CommandContext(ctx, name, grepArgs...).CombinedOutput()
 		if err != nil {
 			if len(out) == 0 {
-				return "no matches found", nil
+				return Result{Output: "no matches found"}, nil
 			}
-			return string(out), nil
+			return Result{Output: string(out)}, nil
 		}
-		return string(out), nil
+		return Result{Output: string(out)}, nil
 	}
 
-	return "", fmt.Errorf("unknown action: %s", args.Action)
+	return Result{}, fmt.Errorf("unknown action: %s", args.Action)
 }
 
-func readFile(path string, offset, limit int) (string, error) {
-	f, err := os.Open(path)
+func readFile(ctx context.Context, path string, offset, limit int) (string, error) {
+	data, err := FSFrom(ctx).ReadFile(ctx, path)
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
 
 	if limit <= 0 {
 		limit = defaultReadLimit
 	}
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
 	lineNum := 0
 	lines := []string{}
 	bytes := 0
@@ -0,0 +1,39 @@
+package tool
+
+import (
+	"context"
+	"os"
+)
+
+// FS reads and writes the files tools edit. Editors that keep their own
+// buffers provide one so the agent sees unsaved changes and its edits go
+// through the editor.
+type FS interface {
+	ReadFile(ctx context.Context, path string) ([]byte, error)
+	WriteFile(ctx context.Context, path string, data []byte, perm os.FileMode) error
+}
+
+type osFS struct{}
+
+func (osFS) ReadFile(_ context.Context, path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (osFS) WriteFile(_ context.Context, path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+type fsKey struct{}
+
+// WithFS makes tools read and write file contents through fs
+func WithFS(ctx context.Context, fs FS) context.Context {
+	return context.WithValue(ctx, fsKey{}, fs)
+}
+
+// FSFrom returns the file system set with WithFS, or the local one
+func FSFrom(ctx context.Context) FS {
+	if fs, ok := ctx.Value(fsKey{}).(FS); ok {
+		return fs
+	}
+	return osFS{}
+}
@@ -161,3 +161,14 @@ func grepFile(cfg *config.Config, path string, re *regexp.Regexp, results *[]str
 	}
 	return scanner.Err()
 }
+
+// Truncate keeps whole match lines so every kept line stays a usable path:line reference
+func (Grep) Truncate(result string, b Budget) string {
+	body, _, _ := strings.Cut(result, "\n\n... (truncated")
+	lines := strings.Split(body, "\n")
+	n := fitLines(lines, b.Tokens-grepNoteTokens, b.Count)
+	return strings.Join(lines[:n], "\n") +
+		fmt.Sprintf("\n\n... (showing %d of %d match lines, narrow the pattern or use glob to see the rest)", n, len(lines))
+}
+
+const grepNoteTokens = 32
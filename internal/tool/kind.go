@@ -0,0 +1,62 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+// Kind says what a call does, for clients that show or gate calls by
+// category: read, edit, search, execute, fetch or other
+func Kind(name string, args json.RawMessage) string {
+	switch name {
+	case "view", "list", "git":
+		return "read"
+	case "edit", "multiedit", "patch":
+		return "edit"
+	case "grep", "glob", "lsp":
+		return "search"
+	case "shell":
+		return "execute"
+	case "webfetch", "websearch":
+		return "fetch"
+	case "file":
+		var a struct {
+			Action string `json:"action"`
+		}
+		json.Unmarshal(args, &a)
+		switch a.Action {
+		case "write":
+			return "edit"
+		case "search":
+			return "search"
+		default:
+			return "read"
+		}
+	}
+	return "other"
+}
+
+// NeedsApproval reports whether a call changes files or runs commands
+func NeedsApproval(name string, args json.RawMessage) bool {
+	k := Kind(name, args)
+	return k == "edit" || k == "execute"
+}
+
+// Approve asks the user whether a call that needs approval may run. A
+// non-nil error refuses it and is what the model is told.
+type Approve func(ctx context.Context, tc types.ToolCall) error
+
+type approveKey struct{}
+
+// WithApproval makes the agent ask approve before edits and commands,
+// including those of sub-agents
+func WithApproval(ctx context.Context, approve Approve) context.Context {
+	return context.WithValue(ctx, approveKey{}, approve)
+}
+
+func ApprovalFrom(ctx context.Context) Approve {
+	approve, _ := ctx.Value(approveKey{}).(Approve)
+	return approve
+}
@@ -0,0 +1,329 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/lsp"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const maxLSPResults = 100
+
+// LSP answers code navigation questions through the configured language
+// server (gopls by default). Servers start on first use and stay up for the session.
+type LSP struct{}
+
+func (LSP) Name() string { return "lsp" }
+func (LSP) Desc() string {
+	return "Navigate code with a language server: go to definition, find references, list document or workspace symbols, show hover type info, or preview a rename. Positions are 1-based; instead of a column you can pass the symbol name found on that line. Results are file:line locations usable with view."
+}
+func (LSP) Args() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"operation": map[string]any{
+				"type":        "string",
+				"enum":        []string{"definition", "references", "document_symbols", "workspace_symbols", "hover", "rename_preview"},
+				"description": "What to look up",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File containing the position (required except for workspace_symbols)",
+			},
+			"line": map[string]any{
+				"type":        "number",
+				"description": "1-based line of the symbol",
+			},
+			"column": map[string]any{
+				"type":        "number",
+				"description": "1-based column of the symbol",
+			},
+			"symbol": map[string]any{
+				"type":        "string",
+				"description": "Symbol name on the given line, used to find the column",
+			},
+			"query": map[string]any{
+				"type":        "string",
+				"description": "Search text for workspace_symbols",
+			},
+			"new_name": map[string]any{
+				"type":        "string",
+				"description": "New name for rename_preview",
+			},
+		},
+		"required": []string{"operation"},
+	}
+}
+
+type lspArgs struct {
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	Symbol    string `json:"symbol"`
+	Query     string `json:"query"`
+	NewName   string `json:"new_name"`
+}
+
+func (LSP) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args lspArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return "", fmt.Errorf("failed to parse arguments: %w", err)
+	}
+
+	if args.Operation == "workspace_symbols" {
+		if args.Query == "" {
+			return "", fmt.Errorf("query is required for workspace_symbols")
+		}
+		c, err := lsp.Shared().For(ctx, args.Path)
+		if err != nil {
+			return "", err
+		}
+		syms, err := c.WorkspaceSymbols(ctx, args.Query)
+		if err != nil {
+			return "", err
+		}
+		return formatSymbols(projectFirst(syms), false), nil
+	}
+
+	if args.Path == "" {
+		return "", fmt.Errorf("path is required for %s", args.Operation)
+	}
+	path, err := filepath.Abs(args.Path)
+	if err != nil {
+		return "", err
+	}
+	if !config.C.CheckReadPermission(args.Path) {
+		return "", fmt.Errorf("permission denied: cannot read %s", args.Path)
+	}
+	c, err := lsp.Shared().For(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	if args.Operation == "document_symbols" {
+		syms, err := c.DocumentSymbols(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		return formatSymbols(syms, true), nil
+	}
+
+	pos, err := lspPosition(path, args)
+	if err != nil {
+		return "", err
+	}
+
+	switch args.Operation {
+	case "definition":
+		locs, err := c.Definition(ctx, path, pos)
+		if err != nil {
+			return "", err
+		}
+		if len(locs) == 0 {
+			return "No definition found", nil
+		}
+		return formatLocations(locs), nil
+	case "references":
+		locs, err := c.References(ctx, path, pos)
+		if err != nil {
+			return "", err
+		}
+		if len(locs) == 0 {
+			return "No references found", nil
+		}
+		return fmt.Sprintf("%d reference(s)\n%s", len(locs), formatLocations(locs)), nil
+	case "hover":
+		text, err := c.Hover(ctx, path, pos)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(text) == "" {
+			return "No hover information", nil
+		}
+		return strings.TrimSpace(text), nil
+	case "rename_preview":
+		if args.NewName == "" {
+			return "", fmt.Errorf("new_name is required for rename_preview")
+		}
+		edits, err := c.Rename(ctx, path, pos, args.NewName)
+		if err != nil {
+			return "", err
+		}
+		return formatRename(edits), nil
+	default:
+		return "", fmt.Errorf("unknown operation %q", args.Operation)
+	}
+}
+
+// lspPosition converts the 1-based line and rune column (or symbol name)
+// into an LSP position, whose character offset counts UTF-16 units
+func lspPosition(path string, args lspArgs) (lsp.Position, error) {
+	if args.Line <= 0 {
+		return lsp.Position{}, fmt.Errorf("line is required for %s", args.Operation)
+	}
+	line, ok := fileLine(path, args.Line)
+	if !ok {
+		return lsp.Position{}, fmt.Errorf("%s has no line %d", args.Path, args.Line)
+	}
+
+	col := args.Column - 1
+	if args.Symbol != "" {
+		idx := strings.Index(line, args.Symbol)
+		if idx < 0 {
+			return lsp.Position{}, fmt.Errorf("symbol %q not found on line %d: %s", args.Symbol, args.Line, strings.TrimSpace(line))
+		}
+		col = len([]rune(line[:idx]))
+	}
+	if col < 0 {
+		// Default to the first identifier on the line
+		col = len([]rune(line)) - len([]rune(strings.TrimLeft(line, " \t")))
+	}
+
+	runes := []rune(line)
+	col = min(col, len(runes))
+	return lsp.Position{Line: args.Line - 1, Character: len(utf16.Encode(runes[:col]))}, nil
+}
+
+// fileLine reads line n of path. Language servers return paths anywhere, so
+// denied files read as missing.
+func fileLine(path string, n int) (string, bool) {
+	if !config.C.CheckReadPermission(path) {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(string(data), "\n")
+	if n < 1 || n > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[n-1], "\r"), true
+}
+
+// formatLocations renders "file:line: snippet" lines
+func formatLocations(locs []lsp.Location) string {
+	var sb strings.Builder
+	for i, l := range locs {
+		if i == maxLSPResults {
+			fmt.Fprintf(&sb, "... and %d more\n", len(locs)-maxLSPResults)
+			break
+		}
+		path := lsp.URIToPath(l.URI)
+		ln := l.Range.Start.Line + 1
+		fmt.Fprintf(&sb, "%s:%d:", types.DisplayPath(path), ln)
+		if snippet, ok := fileLine(path, ln); ok {
+			sb.WriteString(" " + strings.TrimSpace(snippet))
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func formatSymbols(syms []lsp.Symbol, nested bool) string {
+	if len(syms) == 0 {
+		return "No symbols found"
+	}
+	var sb strings.Builder
+	for i, s := range syms {
+		if i == maxLSPResults {
+			fmt.Fprintf(&sb, "... and %d more\n", len(syms)-maxLSPResults)
+			break
+		}
+		name := s.Name
+		if !nested && s.Container != "" {
+			name += " (" + s.Container + ")"
+		}
+		indent := ""
+		if nested {
+			indent = strings.Repeat("  ", s.Depth)
+		}
+		fmt.Fprintf(&sb, "%s:%d: %s%s %s\n", types.DisplayPath(lsp.URIToPath(s.Location.URI)),
+			s.Location.Range.Start.Line+1, indent, lsp.SymbolKindName(s.Kind), name)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// projectFirst drops dependency and stdlib symbols when the project itself has matches
+func projectFirst(syms []lsp.Symbol) []lsp.Symbol {
+	var own []lsp.Symbol
+	for _, s := range syms {
+		if !filepath.IsAbs(types.DisplayPath(lsp.URIToPath(s.Location.URI))) {
+			own = append(own, s)
+		}
+	}
+	if len(own) == 0 {
+		return syms
+	}
+	return own
+}
+
+// formatRename shows each affected line before and after the rename
+func formatRename(edits map[string][]lsp.TextEdit) string {
+	if len(edits) == 0 {
+		return "Rename would change nothing"
+	}
+	paths := make([]string, 0, len(edits))
+	total := 0
+	for p, es := range edits {
+		paths = append(paths, p)
+		total += len(es)
+	}
+	slices.Sort(paths)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Rename would make %d edit(s) in %d file(s). Nothing was written.\n", total, len(paths))
+	shown := 0
+	for _, p := range paths {
+		byLine := make(map[int][]lsp.TextEdit)
+		var lines []int
+		for _, e := range edits[p] {
+			ln := e.Range.Start.Line
+			if _, ok := byLine[ln]; !ok {
+				lines = append(lines, ln)
+			}
+			byLine[ln] = append(byLine[ln], e)
+		}
+		slices.Sort(lines)
+		for _, ln := range lines {
+			if shown == maxLSPResults {
+				sb.WriteString("...\n")
+				return strings.TrimRight(sb.String(), "\n")
+			}
+			shown++
+			old, ok := fileLine(p, ln+1)
+			if !ok {
+				fmt.Fprintf(&sb, "%s:%d: (not readable)\n", types.DisplayPath(p), ln+1)
+				continue
+			}
+			fmt.Fprintf(&sb, "%s:%d:\n  - %s\n  + %s\n", types.DisplayPath(p), ln+1,
+				strings.TrimSpace(old), strings.TrimSpace(applyLineEdits(old, byLine[ln])))
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// applyLineEdits applies single-line edits to line, right to left
+func applyLineEdits(line string, edits []lsp.TextEdit) string {
+	u := utf16.Encode([]rune(line))
+	slices.SortFunc(edits, func(a, b lsp.TextEdit) int { return b.Range.Start.Character - a.Range.Start.Character })
+	for _, e := range edits {
+		if e.Range.End.Line != e.Range.Start.Line {
+			continue
+		}
+		start := min(e.Range.Start.Character, len(u))
+		end := min(max(e.Range.End.Character, start), len(u))
+		repl := utf16.Encode([]rune(e.NewText))
+		u = append(u[:start:start], append(repl, u[end:]...)...)
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,42 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/lsp"
+)
+
+func TestLSPSnippetsRespectDenyRead(t *testing.T) {
+	dir := t.TempDir()
+	open, secret := filepath.Join(dir, "open.go"), filepath.Join(dir, "secret", "key.go")
+	os.MkdirAll(filepath.Dir(secret), 0755)
+	os.WriteFile(open, []byte("var token = 1\n"), 0644)
+	os.WriteFile(secret, []byte("var token = \"hunter2\"\n"), 0644)
+
+	saved := config.C
+	t.Cleanup(func() { config.C = saved })
+	config.C.Security.File.DenyRead = []string{filepath.Join(dir, "secret")}
+
+	at := lsp.Range{Start: lsp.Position{Line: 0, Character: 4}, End: lsp.Position{Line: 0, Character: 9}}
+	refs := formatLocations([]lsp.Location{
+		{URI: lsp.PathToURI(open), Range: at},
+		{URI: lsp.PathToURI(secret), Range: at},
+	})
+	rename := formatRename(map[string][]lsp.TextEdit{
+		open:   {{Range: at, NewText: "secret"}},
+		secret: {{Range: at, NewText: "secret"}},
+	})
+
+	for name, out := range map[string]string{"references": refs, "rename": rename} {
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("%s leaked a denied file:\n%s", name, out)
+		}
+		if !strings.Contains(out, "var token = 1") && !strings.Contains(out, "var secret = 1") {
+			t.Errorf("%s lost the readable snippet:\n%s", name, out)
+		}
+	}
+}
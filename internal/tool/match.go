@@ -0,0 +1,321 @@
+package tool
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/diff"
+)
+
+const (
+	fuzzyThreshold  = 0.85
+	maxFuzzyLineLen = 400
+	// Only this many windows, plus the shifts of the best one, get the
+	// edit distance; the rest are ranked out by trigram overlap
+	maxFuzzyCandidates = 16
+)
+
+// textMatch is the byte range of content that oldText resolved to
+type textMatch struct {
+	start, end int
+	strategy   string
+	// indents maps oldText indentation to the file's, for non-exact matches
+	indents map[string]string
+}
+
+// lineEq compares a file line to an oldText line
+type lineEq func(file, old string) bool
+
+var lineStrategies = []struct {
+	name string
+	eq   lineEq
+}{
+	{"ignoring trailing whitespace", func(a, b string) bool {
+		return strings.TrimRight(a, " \t\r") == strings.TrimRight(b, " \t\r")
+	}},
+	{"ignoring indentation", func(a, b string) bool {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}},
+}
+
+// findMatch locates oldText in content. It tries an exact match, then
+// line-based matches that ignore trailing whitespace and indentation, then a
+// fuzzy line match. Every strategy must resolve to exactly one region.
+func findMatch(content, oldText string) (textMatch, error) {
+	switch n := strings.Count(content, oldText); {
+	case n == 1:
+		i := strings.Index(content, oldText)
+		return textMatch{start: i, end: i + len(oldText), strategy: "exact"}, nil
+	case n > 1:
+		return textMatch{}, fmt.Errorf("oldText appears %d times in the file. Please provide more context to make it unique", n)
+	}
+
+	lines := strings.Split(content, "\n")
+	offsets := lineOffsets(lines)
+	oldLines := strings.Split(strings.TrimSuffix(oldText, "\n"), "\n")
+	trailingNL := strings.HasSuffix(oldText, "\n")
+
+	region := func(first int, strategy string) textMatch {
+		last := first + len(oldLines) - 1
+		end := offsets[last] + len(lines[last])
+		if trailingNL && end < len(content) {
+			end++
+		}
+		return textMatch{
+			start:    offsets[first],
+			end:      end,
+			strategy: strategy,
+			indents:  indentMap(oldLines, lines[first:last+1]),
+		}
+	}
+
+	for _, s := range lineStrategies {
+		var found []int
+		for i := 0; i+len(oldLines) <= len(lines); i++ {
+			if windowMatches(lines[i:i+len(oldLines)], oldLines, s.eq) {
+				found = append(found, i)
+			}
+		}
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return region(found[0], s.name), nil
+		default:
+			return textMatch{}, fmt.Errorf("oldText matches %d regions (%s) at lines %s. Please provide more context to make it unique", len(found), s.name, lineList(found))
+		}
+	}
+
+	best, score, rival := closestWindow(lines, oldLines)
+	if best >= 0 && score >= fuzzyThreshold && rival < fuzzyThreshold {
+		return region(best, fmt.Sprintf("fuzzy, %.0f%% similar", score*100)), nil
+	}
+	return textMatch{}, notFoundError(lines, oldLines, best, score)
+}
+
+func windowMatches(window, old []string, eq lineEq) bool {
+	for i := range old {
+		if !eq(window[i], old[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func lineOffsets(lines []string) []int {
+	offsets := make([]int, len(lines))
+	pos := 0
+	for i, l := range lines {
+		offsets[i] = pos
+		pos += len(l) + 1
+	}
+	return offsets
+}
+
+func lineList(starts []int) string {
+	var s []string
+	for i, n := range starts {
+		if i == 5 {
+			s = append(s, "...")
+			break
+		}
+		s = append(s, fmt.Sprint(n+1))
+	}
+	return strings.Join(s, ", ")
+}
+
+// closestWindow scores the windows of len(old) lines most like old and
+// returns the best start, its score, and the best score of a window not
+// overlapping it
+func closestWindow(lines, old []string) (best int, score, rival float64) {
+	best = -1
+	n := len(lines) - len(old) + 1
+	if n <= 0 {
+		return best, 0, 0
+	}
+
+	// Rank windows by trigram overlap first: Levenshtein on every window is
+	// quadratic in line length for each line of the file
+	fileGrams := make([]trigrams, len(lines))
+	for i, l := range lines {
+		fileGrams[i] = newTrigrams(l)
+	}
+	oldGrams := make([]trigrams, len(old))
+	for i, l := range old {
+		oldGrams[i] = newTrigrams(l)
+	}
+	overlap := make([]float64, n)
+	order := make([]int, n)
+	for i := range n {
+		order[i] = i
+		for j := range old {
+			overlap[i] += oldGrams[j].dice(fileGrams[i+j])
+		}
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(overlap[b], overlap[a]) })
+	// Shifts of the best region crowd the top of the ranking, so leave room for a rival past them
+	order = order[:min(n, maxFuzzyCandidates+2*len(old))]
+
+	scores := make(map[int]float64, len(order))
+	for _, i := range order {
+		s := windowSimilarity(lines[i:i+len(old)], old)
+		scores[i] = s
+		if best < 0 || s > score || (s == score && i < best) {
+			best, score = i, s
+		}
+	}
+	for i, s := range scores {
+		// A window overlapping the best one is the same region shifted, not a rival
+		if (i <= best-len(old) || i >= best+len(old)) && s > rival {
+			rival = s
+		}
+	}
+	return best, score, rival
+}
+
+// trigrams is the set of 3-byte substrings of a trimmed line
+type trigrams map[string]struct{}
+
+func newTrigrams(line string) trigrams {
+	line = strings.TrimSpace(line)
+	if len(line) > maxFuzzyLineLen {
+		line = line[:maxFuzzyLineLen]
+	}
+	// Padding gives short and empty lines at least one trigram
+	line = "  " + line + " "
+	t := make(trigrams, len(line)-2)
+	for i := 0; i+3 <= len(line); i++ {
+		t[line[i:i+3]] = struct{}{}
+	}
+	return t
+}
+
+// dice is the Sørensen–Dice coefficient of two trigram sets
+func (t trigrams) dice(o trigrams) float64 {
+	small, large := t, o
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	common := 0
+	for g := range small {
+		if _, ok := large[g]; ok {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(t)+len(o))
+}
+
+func windowSimilarity(window, old []string) float64 {
+	var total float64
+	for i := range old {
+		total += similarity(strings.TrimSpace(window[i]), strings.TrimSpace(old[i]))
+	}
+	return total / float64(len(old))
+}
+
+// similarity is 1 minus the normalized Levenshtein distance
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) > maxFuzzyLineLen {
+		ra = ra[:maxFuzzyLineLen]
+	}
+	if len(rb) > maxFuzzyLineLen {
+		rb = rb[:maxFuzzyLineLen]
+	}
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// indentMap pairs the leading whitespace of oldText lines with the file's
+func indentMap(old, file []string) map[string]string {
+	m := make(map[string]string)
+	for i := range old {
+		if strings.TrimSpace(old[i]) == "" {
+			continue
+		}
+		o, f := leadingSpace(old[i]), leadingSpace(file[i])
+		if _, ok := m[o]; !ok && o != f {
+			m[o] = f
+		}
+	}
+	return m
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// reindent rewrites newText's indentation the way the matched region
+// differs from oldText, so a space-indented edit lands tab-indented in a
+// tab-indented file
+func reindent(newText string, indents map[string]string) string {
+	if len(indents) == 0 {
+		return newText
+	}
+	lines := strings.Split(newText, "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		lead := leadingSpace(l)
+		best := ""
+		for o := range indents {
+			if strings.HasPrefix(lead, o) && len(o) > len(best) {
+				best = o
+			}
+		}
+		if best != "" || indents[""] != "" {
+			lines[i] = indents[best] + l[len(best):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notFoundError shows the closest region with line numbers and its diff against oldText
+func notFoundError(lines, old []string, best int, score float64) error {
+	if best < 0 {
+		return fmt.Errorf("oldText not found in file (the file has fewer lines than oldText)")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "oldText not found in file. Closest region is lines %d-%d (%.0f%% similar):\n", best+1, best+len(old), score*100)
+	region := lines[best : best+len(old)]
+	for i, l := range region {
+		fmt.Fprintf(&b, "%d| %s\n", best+i+1, l)
+	}
+	b.WriteString("\nDiff from oldText (-) to the file (+):\n")
+	for _, l := range diff.Lines(old, region) {
+		b.WriteByte(byte(l.Kind))
+		b.WriteString(l.Text)
+		b.WriteByte('\n')
+	}
+	b.WriteString("\nCopy the exact text from the file (use view) and retry.")
+	return fmt.Errorf("%s", b.String())
+}
@@ -0,0 +1,39 @@
+package tool
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFindMatchFuzzyInLargeFile(t *testing.T) {
+	var b strings.Builder
+	for i := range 5000 {
+		fmt.Fprintf(&b, "\tvalue%d := compute(%d, \"some filler text to make the line longer\")\n", i, i)
+	}
+	b.WriteString("func target() {\n\treturn fetchUser(ctx, id)\n}\n")
+	content := b.String()
+
+	m, err := findMatch(content, "func target() {\n\treturn fetchUsr(ctx, id)\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(m.strategy, "fuzzy") || !strings.HasPrefix(content[m.start:], "func target()") {
+		t.Fatalf("matched %q with %s", content[m.start:m.end], m.strategy)
+	}
+}
+
+func TestFindMatchFuzzyRival(t *testing.T) {
+	block := "if err != nil {\n\treturn fmt.Errorf(\"load config: %w\", err)\n}\n"
+	var b strings.Builder
+	b.WriteString(block)
+	for i := range 200 {
+		fmt.Fprintf(&b, "x%d := %d\n", i, i)
+	}
+	b.WriteString(block)
+
+	_, err := findMatch(b.String(), "if err != nil {\n\treturn fmt.Errorf(\"load configs: %w\", err)\n}\n")
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("err = %v, want not found for two equally close regions", err)
+	}
+}
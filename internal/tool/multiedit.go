@@ -0,0 +1,138 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/diff"
+)
+
+// MultiEdit applies an ordered list of exact-text replacements across one or
+// more files. Every edit is checked in memory first, then all files are
+// written together or not at all.
+type MultiEdit struct{}
+
+func (MultiEdit) Name() string { return "multiedit" }
+func (MultiEdit) Desc() string {
+	return "Apply several exact-text edits across one or more files atomically. Edits run in order (later edits see earlier ones); if any edit fails nothing is written. Returns a combined diff."
+}
+func (MultiEdit) Args() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"edits": map[string]any{
+				"type":        "array",
+				"description": "Edits to apply in order",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"path": map[string]any{
+							"type":        "string",
+							"description": "Path to the file to edit",
+						},
+						"oldText": map[string]any{
+							"type":        "string",
+							"description": "Exact text to replace. Empty creates the file with newText (file must not exist)",
+						},
+						"newText": map[string]any{
+							"type":        "string",
+							"description": "Replacement text",
+						},
+						"replaceAll": map[string]any{
+							"type":        "boolean",
+							"description": "Replace every occurrence instead of requiring a unique match (default: false)",
+						},
+					},
+					"required": []string{"path", "oldText", "newText"},
+				},
+			},
+		},
+		"required": []string{"edits"},
+	}
+}
+
+type editOp struct {
+	Path       string `json:"path"`
+	OldText    string `json:"oldText"`
+	NewText    string `json:"newText"`
+	ReplaceAll bool   `json:"replaceAll"`
+}
+
+func (m MultiEdit) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	r, err := m.RunResult(ctx, raw)
+	return r.Output, err
+}
+
+func (m MultiEdit) RunResult(ctx context.Context, raw json.RawMessage) (Result, error) {
+	var args struct {
+		Edits []editOp `json:"edits"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return Result{}, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if len(args.Edits) == 0 {
+		return Result{}, fmt.Errorf("edits is required")
+	}
+
+	var changes []*fileChange
+	byPath := make(map[string]*fileChange)
+	for i, e := range args.Edits {
+		if e.Path == "" {
+			return Result{}, fmt.Errorf("edit %d: path is required", i+1)
+		}
+		path := filepath.Clean(e.Path)
+		c, ok := byPath[path]
+		if !ok {
+			var err error
+			c, err = loadChange(ctx, path, e.OldText == "")
+			if err != nil {
+				return Result{}, fmt.Errorf("edit %d: %w", i+1, err)
+			}
+			byPath[path] = c
+			changes = append(changes, c)
+		}
+		if err := applyEdit(c, e); err != nil {
+			return Result{}, fmt.Errorf("edit %d (%s): %w. No files were changed", i+1, path, err)
+		}
+	}
+
+	if err := applyChanges(ctx, changes); err != nil {
+		return Result{}, err
+	}
+
+	files := changeDiffs(changes)
+	return Result{
+		Output: fmt.Sprintf("✓ Applied %d edit(s) to %d file(s)\n\n%s", len(args.Edits), len(files), diff.Unified(files)),
+		Diffs:  files,
+	}, nil
+}
+
+func applyEdit(c *fileChange, e editOp) error {
+	if e.OldText == "" {
+		if c.existed || c.new != "" {
+			return fmt.Errorf("oldText is empty but the file already has content")
+		}
+		c.new = e.NewText
+		return nil
+	}
+	if e.ReplaceAll {
+		if !strings.Contains(c.new, e.OldText) {
+			return fmt.Errorf("oldText not found")
+		}
+		c.new = strings.ReplaceAll(c.new, e.OldText, e.NewText)
+		return nil
+	}
+	m, err := findMatch(c.new, e.OldText)
+	if err != nil {
+		return err
+	}
+	newText := e.NewText
+	if m.strategy != "exact" {
+		newText = reindent(newText, m.indents)
+	}
+	c.new = c.new[:m.start] + newText + c.new[m.end:]
+	return nil
+}
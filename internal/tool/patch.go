@@ -0,0 +1,396 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/diff"
+)
+
+const maxPatchFuzz = 2
+
+// Patch applies a unified diff. Hunks are located near their stated line
+// numbers, tolerating shifted offsets, whitespace differences and (with
+// fuzz) stale context lines. All files are written together or not at all.
+type Patch struct{}
+
+func (Patch) Name() string { return "patch" }
+func (Patch) Desc() string {
+	return "Apply a unified diff (as produced by `git diff` or `diff -u`) to one or more files atomically. Supports creating (--- /dev/null), deleting (+++ /dev/null) and renaming files. Hunks are matched fuzzily near their line numbers. Returns the resulting combined diff."
+}
+func (Patch) Args() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"patch": map[string]any{
+				"type":        "string",
+				"description": "Unified diff text with ---/+++ file headers and @@ hunks",
+			},
+			"root": map[string]any{
+				"type":        "string",
+				"description": "Directory the patch paths are relative to (default: current directory)",
+			},
+		},
+		"required": []string{"patch"},
+	}
+}
+
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []patchHunk
+}
+
+type patchHunk struct {
+	oldStart int
+	lines    []diff.Line
+	// "\ No newline at end of file" followed the last old or new line
+	oldNoEOL, newNoEOL bool
+}
+
+func (p Patch) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	r, err := p.RunResult(ctx, raw)
+	return r.Output, err
+}
+
+func (p Patch) RunResult(ctx context.Context, raw json.RawMessage) (Result, error) {
+	var args struct {
+		Patch string `json:"patch"`
+		Root  string `json:"root"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return Result{}, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Patch) == "" {
+		return Result{}, fmt.Errorf("patch is required")
+	}
+	if args.Root == "" {
+		args.Root = "."
+	}
+
+	patches, err := parsePatch(args.Patch)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var changes []*fileChange
+	byPath := make(map[string]*fileChange)
+	load := func(path string, allowMissing bool) (*fileChange, error) {
+		if c, ok := byPath[path]; ok {
+			return c, nil
+		}
+		c, err := loadChange(ctx, path, allowMissing)
+		if err != nil {
+			return nil, err
+		}
+		byPath[path] = c
+		changes = append(changes, c)
+		return c, nil
+	}
+
+	for _, fp := range patches {
+		create := fp.oldPath == "/dev/null"
+		remove := fp.newPath == "/dev/null"
+		src := filepath.Join(args.Root, fp.oldPath)
+		if create {
+			src = filepath.Join(args.Root, fp.newPath)
+		}
+
+		c, err := load(src, create)
+		if err != nil {
+			return Result{}, err
+		}
+		if create && c.new != "" {
+			return Result{}, fmt.Errorf("%s: patch creates the file but it already exists", src)
+		}
+
+		content, err := applyHunks(c.new, fp.hunks)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %w. No files were changed", src, err)
+		}
+
+		switch {
+		case remove:
+			c.new, c.remove = "", true
+		case !create && fp.newPath != fp.oldPath:
+			dst, err := load(filepath.Join(args.Root, fp.newPath), true)
+			if err != nil {
+				return Result{}, err
+			}
+			if dst.new != "" {
+				return Result{}, fmt.Errorf("cannot rename %s: %s already exists", src, dst.path)
+			}
+			dst.new, dst.mode = content, c.mode
+			c.new, c.remove = "", true
+		default:
+			c.new = content
+		}
+	}
+
+	if err := applyChanges(ctx, changes); err != nil {
+		return Result{}, err
+	}
+
+	files := changeDiffs(changes)
+	return Result{
+		Output: fmt.Sprintf("✓ Patched %d file(s)\n\n%s", len(files), diff.Unified(files)),
+		Diffs:  files,
+	}, nil
+}
+
+func parsePatch(text string) ([]filePatch, error) {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	lines := strings.Split(text, "\n")
+	var patches []filePatch
+	var cur *filePatch
+	var hunk *patchHunk
+
+	flush := func() {
+		if cur != nil && hunk != nil {
+			cur.hunks = append(cur.hunks, *hunk)
+		}
+		hunk = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		isHeader := strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+
+		switch {
+		case isHeader:
+			flush()
+			patches = append(patches, filePatch{
+				oldPath: patchPath(line[4:]),
+				newPath: patchPath(lines[i+1][4:]),
+			})
+			cur = &patches[len(patches)-1]
+			i++
+		case strings.HasPrefix(line, "@@"):
+			flush()
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk without a ---/+++ file header", i+1)
+			}
+			start, err := hunkStart(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			hunk = &patchHunk{oldStart: start}
+		case hunk != nil && strings.HasPrefix(line, "\\"):
+			// "\ No newline at end of file" marks the line before it
+			if n := len(hunk.lines); n > 0 {
+				kind := hunk.lines[n-1].Kind
+				hunk.oldNoEOL = hunk.oldNoEOL || kind != diff.Insert
+				hunk.newNoEOL = hunk.newNoEOL || kind != diff.Delete
+			}
+		case hunk != nil && (line == "" || strings.ContainsRune(" +-", rune(line[0]))):
+			if line == "" {
+				// Editors and models often strip the space of empty context lines
+				hunk.lines = append(hunk.lines, diff.Line{Kind: diff.Equal})
+				continue
+			}
+			hunk.lines = append(hunk.lines, diff.Line{Kind: diff.Kind(line[0]), Text: line[1:]})
+		default:
+			// diff --git, index and mode lines
+			flush()
+		}
+	}
+	flush()
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers found, expected unified diff with ---/+++ lines")
+	}
+	for _, p := range patches {
+		if len(p.hunks) == 0 && p.newPath != "/dev/null" {
+			return nil, fmt.Errorf("%s: no hunks found", p.newPath)
+		}
+	}
+	return patches, nil
+}
+
+// patchPath strips timestamps and the a/ b/ prefixes from a header path
+func patchPath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return s
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return filepath.Clean(s)
+}
+
+// hunkStart parses the old start line from "@@ -l,s +l,s @@"
+func hunkStart(header string) (int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") {
+		return 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	num, _, _ := strings.Cut(fields[1][1:], ",")
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	return n, nil
+}
+
+func applyHunks(content string, hunks []patchHunk) (string, error) {
+	lines := diff.SplitLines(content)
+	// Keep the file's final newline unless a hunk says otherwise
+	eol := content == "" || strings.HasSuffix(content, "\n")
+	offset := 0
+	for i, h := range hunks {
+		if h.newNoEOL {
+			eol = false
+		} else if h.oldNoEOL {
+			eol = true
+		}
+		var err error
+		var delta int
+		lines, delta, err = applyHunk(lines, h, h.oldStart-1+offset)
+		if err != nil {
+			return "", fmt.Errorf("hunk %d (@@ -%d): %w", i+1, h.oldStart, err)
+		}
+		offset += delta
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	content = strings.Join(lines, "\n")
+	if eol {
+		content += "\n"
+	}
+	return content, nil
+}
+
+// applyHunk locates h near hint and splices it in, dropping up to
+// maxPatchFuzz context lines from either end when the context is stale
+func applyHunk(lines []string, h patchHunk, hint int) ([]string, int, error) {
+	body, at := h.lines, hint
+	for fuzz := 0; fuzz <= maxPatchFuzz; fuzz++ {
+		if fuzz > 0 {
+			trimmed, lead, ok := trimContext(h.lines, fuzz)
+			if !ok {
+				break
+			}
+			body, at = trimmed, hint+lead
+		}
+
+		var old []string
+		for _, l := range body {
+			if l.Kind != diff.Insert {
+				old = append(old, l.Text)
+			}
+		}
+		if len(old) == 0 {
+			if fuzz > 0 {
+				// All context was trimmed, so nothing anchors the insert
+				break
+			}
+			pos := min(max(hint+1, 0), len(lines))
+			if h.oldStart == 0 {
+				pos = 0
+			}
+			return splice(lines, pos, body), countInserts(body), nil
+		}
+
+		if pos, ok := findBlock(lines, old, at); ok {
+			return splice(lines, pos, body), countInserts(body) - countDeletes(body), nil
+		}
+	}
+	return nil, 0, fmt.Errorf("context does not match the file")
+}
+
+// trimContext drops up to n leading and trailing context lines, returning
+// how many leading lines went
+func trimContext(lines []diff.Line, n int) ([]diff.Line, int, bool) {
+	start, end := 0, len(lines)
+	for i := 0; i < n && start < end && lines[start].Kind == diff.Equal; i++ {
+		start++
+	}
+	for i := 0; i < n && end > start && lines[end-1].Kind == diff.Equal; i++ {
+		end--
+	}
+	if start == 0 && end == len(lines) {
+		return nil, 0, false
+	}
+	return lines[start:end], start, true
+}
+
+// findBlock searches outward from hint for old, first exactly, then ignoring
+// surrounding whitespace
+func findBlock(lines, old []string, hint int) (int, bool) {
+	last := len(lines) - len(old)
+	if last < 0 {
+		return 0, false
+	}
+	hint = min(max(hint, 0), last)
+	for _, eq := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+	} {
+		for d := 0; d <= last; d++ {
+			for _, pos := range []int{hint - d, hint + d} {
+				if pos < 0 || pos > last || (d == 0 && pos != hint) {
+					continue
+				}
+				if blockMatches(lines[pos:pos+len(old)], old, eq) {
+					return pos, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func blockMatches(lines, old []string, eq func(a, b string) bool) bool {
+	for i := range old {
+		if !eq(lines[i], old[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splice replaces the block at pos with the hunk's new side, keeping the
+// file's own text for context lines
+func splice(lines []string, pos int, body []diff.Line) []string {
+	out := append([]string(nil), lines[:pos]...)
+	i := pos
+	for _, l := range body {
+		switch l.Kind {
+		case diff.Equal:
+			out = append(out, lines[i])
+			i++
+		case diff.Delete:
+			i++
+		case diff.Insert:
+			out = append(out, l.Text)
+		}
+	}
+	return append(out, lines[i:]...)
+}
+
+func countInserts(body []diff.Line) int {
+	n := 0
+	for _, l := range body {
+		if l.Kind == diff.Insert {
+			n++
+		}
+	}
+	return n
+}
+
+func countDeletes(body []diff.Line) int {
+	n := 0
+	for _, l := range body {
+		if l.Kind == diff.Delete {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package tool
+
+import "testing"
+
+func TestPatchNoNewlineAtEOF(t *testing.T) {
+	tests := []struct {
+		name, content, patch, want string
+	}{
+		{
+			name:    "both sides without newline",
+			content: "a\nold",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-old\n\\ No newline at end of file\n+new\n\\ No newline at end of file\n",
+			want:    "a\nnew",
+		},
+		{
+			name:    "newline added",
+			content: "a\nold",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-old\n\\ No newline at end of file\n+new\n",
+			want:    "a\nnew\n",
+		},
+		{
+			name:    "newline removed",
+			content: "a\nold\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-old\n+new\n\\ No newline at end of file\n",
+			want:    "a\nnew",
+		},
+		{
+			name:    "unmarked hunk keeps the missing newline",
+			content: "a\nb\nc",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n-a\n+x\n b\n",
+			want:    "x\nb\nc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := parsePatch(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(patches) != 1 || len(patches[0].hunks) != 1 {
+				t.Fatalf("parsed %d patches, want 1 with 1 hunk", len(patches))
+			}
+			got, err := applyHunks(tt.content, patches[0].hunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchFuzz(t *testing.T) {
+	tests := []struct {
+		name, content, patch, want string
+		wantErr                    bool
+	}{
+		{
+			name:    "stale leading context",
+			content: "a\nb\nc\nd\ne\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -2,4 +2,4 @@\n stale\n c\n-d\n+D\n e\n",
+			want:    "a\nb\nc\nD\ne\n",
+		},
+		{
+			name:    "no context left after trimming",
+			content: "one\ntwo\nthree\nfour\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -2,3 +2,4 @@\n foo\n+INSERTED\n bar\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := parsePatch(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyHunks(tt.content, patches[0].hunks)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applied to %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package tool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CheckArgs validates raw against t's argument schema before the tool runs.
+// Mistakes weaker models often make are repaired: text around the JSON,
+// code fences, single quotes, trailing commas, arguments sent as a JSON
+// string, and numbers or booleans sent as strings. It returns the arguments
+// to run with and what was repaired, or an error naming each problem and
+// the expected arguments.
+func CheckArgs(t Tool, raw json.RawMessage) (json.RawMessage, []string, error) {
+	v, repairs, err := parseLoose(string(raw))
+	if err != nil {
+		return nil, nil, fmt.Errorf("arguments are not valid JSON: %v. Expected: %s", err, Signature(t))
+	}
+	if s, ok := v.(string); ok {
+		if inner, _, err := parseLoose(s); err == nil {
+			if _, isObj := inner.(map[string]any); isObj {
+				v = inner
+				repairs = append(repairs, "decoded arguments sent as a JSON string")
+			}
+		}
+	}
+
+	c := checker{}
+	v = c.check("", v, t.Args())
+	if len(c.problems) > 0 {
+		return nil, nil, fmt.Errorf("invalid arguments: %s. Expected: %s", strings.Join(c.problems, "; "), Signature(t))
+	}
+	repairs = append(repairs, c.repairs...)
+	if len(repairs) == 0 {
+		return raw, nil, nil
+	}
+	fixed, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fixed, repairs, nil
+}
+
+// parseLoose decodes a JSON value, retrying with repairs when it doesn't parse
+func parseLoose(s string) (any, []string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return map[string]any{}, []string{"treated empty arguments as {}"}, nil
+	}
+	v, rest, firstErr := decodeFirst(s)
+	if firstErr == nil && rest == "" {
+		return v, nil, nil
+	}
+
+	var repairs []string
+	if inner, ok := stripFence(s); ok {
+		s = inner
+		repairs = append(repairs, "removed code fence")
+	}
+	if i := strings.IndexAny(s, "{["); i > 0 {
+		s = s[i:]
+		repairs = append(repairs, "ignored text before the JSON")
+	}
+	if q := fixQuotes(s); q != s {
+		s = q
+		repairs = append(repairs, "converted single quotes")
+	}
+	if c := dropTrailingCommas(s); c != s {
+		s = c
+		repairs = append(repairs, "removed trailing commas")
+	}
+	v, rest, err := decodeFirst(s)
+	if err != nil {
+		if firstErr != nil {
+			err = firstErr
+		}
+		return nil, nil, err
+	}
+	if rest != "" {
+		repairs = append(repairs, "ignored text after the JSON")
+	}
+	return v, repairs, nil
+}
+
+// decodeFirst decodes the first JSON value in s and returns what follows it
+func decodeFirst(s string) (any, string, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return nil, "", fmt.Errorf("%v at offset %d near %q", err, syntax.Offset, around(s, int(syntax.Offset)))
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, "", errors.New("unexpected end of input, the JSON is cut off")
+		}
+		return nil, "", err
+	}
+	return v, strings.TrimSpace(s[dec.InputOffset():]), nil
+}
+
+func around(s string, offset int) string {
+	start := max(offset-15, 0)
+	end := min(offset+15, len(s))
+	return s[start:end]
+}
+
+func stripFence(s string) (string, bool) {
+	start := strings.Index(s, "```")
+	if start < 0 {
+		return s, false
+	}
+	body := s[start+3:]
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 && !strings.ContainsAny(body[:nl], "{[") {
+		body = body[nl+1:] // language tag
+	}
+	if end := strings.LastIndex(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return strings.TrimSpace(body), true
+}
+
+// fixQuotes rewrites single-quoted strings as double-quoted ones
+func fixQuotes(s string) string {
+	var b strings.Builder
+	var quote byte // the quote of the string being copied, 0 outside strings
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == 0 && c == '\'':
+			quote = c
+			b.WriteByte('"')
+		case quote == 0:
+			if c == '"' {
+				quote = c
+			}
+			b.WriteByte(c)
+		case c == '\\' && i+1 < len(s):
+			if quote == '\'' && s[i+1] == '\'' {
+				b.WriteByte('\'')
+			} else {
+				b.WriteByte(c)
+				b.WriteByte(s[i+1])
+			}
+			i++
+		case c == quote:
+			quote = 0
+			b.WriteByte('"')
+		case c == '"' && quote == '\'':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// dropTrailingCommas removes commas directly before a closing brace or bracket
+func dropTrailingCommas(s string) string {
+	var b strings.Builder
+	inString := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			b.WriteByte(c)
+			if c == '\\' && i+1 < len(s) {
+				b.WriteByte(s[i+1])
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == ',' {
+			next := strings.TrimLeft(s[i+1:], " \t\r\n")
+			if next != "" && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+		}
+		if c == '"' {
+			inString = true
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// checker walks a value alongside its schema, coercing what it safely can
+type checker struct {
+	problems []string
+	repairs  []string
+}
+
+func (c *checker) problem(path, format string, args ...any) {
+	if path == "" {
+		path = "arguments"
+	}
+	c.problems = append(c.problems, path+" "+fmt.Sprintf(format, args...))
+}
+
+func (c *checker) repair(path, what string) {
+	c.repairs = append(c.repairs, path+": "+what)
+}
+
+func (c *checker) check(path string, v any, schema map[string]any) any {
+	if enum := stringList(schema["enum"]); len(enum) > 0 {
+		return c.checkEnum(path, v, enum)
+	}
+	switch typ, _ := schema["type"].(string); typ {
+	case "object":
+		if s, ok := v.(string); ok {
+			if inner, _, err := parseLoose(s); err == nil {
+				if _, isObj := inner.(map[string]any); isObj {
+					c.repair(path, "decoded object sent as a string")
+					v = inner
+				}
+			}
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			c.problem(path, "must be an object, got %s", describe(v))
+			return v
+		}
+		return c.checkObject(path, obj, schema)
+	case "array":
+		if s, ok := v.(string); ok {
+			if inner, _, err := parseLoose(s); err == nil {
+				if _, isArr := inner.([]any); isArr {
+					c.repair(path, "decoded array sent as a string")
+					v = inner
+				}
+			}
+		}
+		arr, ok := v.([]any)
+		if !ok {
+			c.problem(path, "must be an array, got %s", describe(v))
+			return v
+		}
+		items, _ := schema["items"].(map[string]any)
+		if items == nil {
+			return arr
+		}
+		for i, item := range arr {
+			arr[i] = c.check(fmt.Sprintf("%s[%d]", path, i), item, items)
+		}
+		return arr
+	case "string":
+		switch x := v.(type) {
+		case string:
+			return x
+		case json.Number:
+			c.repair(path, "number sent for a string")
+			return x.String()
+		case bool:
+			c.repair(path, "boolean sent for a string")
+			return strconv.FormatBool(x)
+		}
+		c.problem(path, "must be a string, got %s", describe(v))
+	case "number", "integer":
+		n, ok := v.(json.Number)
+		if s, isStr := v.(string); isStr {
+			if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				n, ok = json.Number(strings.TrimSpace(s)), true
+				c.repair(path, "number sent as a string")
+			}
+		}
+		if !ok {
+			c.problem(path, "must be a %s, got %s", typ, describe(v))
+			return v
+		}
+		if typ == "integer" {
+			f, _ := n.Float64()
+			if f != float64(int64(f)) {
+				c.problem(path, "must be an integer, got %s", n)
+				return v
+			}
+			n = json.Number(strconv.FormatInt(int64(f), 10))
+		}
+		return n
+	case "boolean":
+		switch x := v.(type) {
+		case bool:
+			return x
+		case string:
+			if b, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(x))); err == nil {
+				c.repair(path, "boolean sent as a string")
+				return b
+			}
+		}
+		c.problem(path, "must be a boolean, got %s", describe(v))
+	}
+	return v
+}
+
+func (c *checker) checkObject(path string, obj map[string]any, schema map[string]any) map[string]any {
+	props, _ := schema["properties"].(map[string]any)
+	required := stringList(schema["required"])
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		val := obj[name]
+		if val == nil {
+			if !slices.Contains(required, name) {
+				delete(obj, name) // null for an optional field means "not set"
+			}
+			continue
+		}
+		ps, ok := props[name].(map[string]any)
+		if !ok {
+			continue // tools ignore extra fields
+		}
+		obj[name] = c.check(prefix+name, val, ps)
+	}
+	for _, name := range required {
+		if v, ok := obj[name]; !ok || v == nil {
+			c.problem(prefix+name, "is required")
+		}
+	}
+	return obj
+}
+
+func (c *checker) checkEnum(path string, v any, enum []string) any {
+	s, ok := v.(string)
+	if !ok {
+		c.problem(path, "must be one of %s, got %s", quoteList(enum), describe(v))
+		return v
+	}
+	if slices.Contains(enum, s) {
+		return s
+	}
+	for _, e := range enum {
+		if strings.EqualFold(e, strings.TrimSpace(s)) {
+			c.repair(path, "matched enum ignoring case")
+			return e
+		}
+	}
+	c.problem(path, "must be one of %s, got %q", quoteList(enum), s)
+	return v
+}
+
+func describe(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string " + strconv.Quote(x)
+	case json.Number:
+		return "number " + x.String()
+	case bool:
+		return "boolean " + strconv.FormatBool(x)
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func stringList(v any) []string {
+	switch x := v.(type) {
+	case []string:
+		return x
+	case []any:
+		var out []string
+		for _, e := range x {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = strconv.Quote(s)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Signature describes a tool's arguments in one line, e.g.
+// edit(path: string, oldText: string, newText: string, replaceAll?: boolean)
+func Signature(t Tool) string {
+	return t.Name() + "(" + strings.TrimSuffix(strings.TrimPrefix(typeString(t.Args()), "{"), "}") + ")"
+}
+
+func typeString(schema map[string]any) string {
+	if enum := stringList(schema["enum"]); len(enum) > 0 {
+		return strings.Join(strings.Split(quoteList(enum), ", "), "|")
+	}
+	switch typ, _ := schema["type"].(string); typ {
+	case "object":
+		props, _ := schema["properties"].(map[string]any)
+		required := stringList(schema["required"])
+		var names []string
+		for name := range props {
+			if !slices.Contains(required, name) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		var fields []string
+		for _, name := range slices.Concat(required, names) {
+			ps, ok := props[name].(map[string]any)
+			if !ok {
+				continue
+			}
+			opt := "?"
+			if slices.Contains(required, name) {
+				opt = ""
+			}
+			fields = append(fields, name+opt+": "+typeString(ps))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	case "array":
+		if items, ok := schema["items"].(map[string]any); ok {
+			return "[" + typeString(items) + "]"
+		}
+		return "array"
+	case "":
+		return "any"
+	default:
+		return typ
+	}
+}
@@ -0,0 +1,79 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/mode"
+)
+
+// Task delegates work to a sub-agent with its own history. The agent
+// intercepts calls to it; Run only parses the arguments.
+type Task struct{}
+
+// TaskArgs are the arguments of a task call
+type TaskArgs struct {
+	Description string `json:"description"`
+	Prompt      string `json:"prompt"`
+	Mode        string `json:"mode"`
+	MaxSteps    int    `json:"max_steps"`
+}
+
+func (Task) Name() string { return "task" }
+func (Task) Desc() string {
+	var names []string
+	for _, m := range mode.All() {
+		names = append(names, m.Name)
+	}
+	return "Run a sub-agent on a self-contained task, such as searching a large codebase or investigating one question, without filling your context. " +
+		"The sub-agent starts with no history, so the prompt must include everything it needs. Only its final report is returned. " +
+		"Several task calls in one response run concurrently. Sub-agents can only read, unless their mode lists write tools. Modes: " + strings.Join(names, ", ") + "."
+}
+func (Task) Args() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"description": map[string]any{
+				"type":        "string",
+				"description": "Short (3-5 words) label for the task",
+			},
+			"prompt": map[string]any{
+				"type":        "string",
+				"description": "Full instructions for the sub-agent, including what to report back",
+			},
+			"mode": map[string]any{
+				"type":        "string",
+				"description": "Agent mode for the sub-agent (default: explore)",
+			},
+			"max_steps": map[string]any{
+				"type":        "number",
+				"description": "Step budget for the sub-agent (default: 30)",
+			},
+		},
+		"required": []string{"description", "prompt"},
+	}
+}
+
+// ParseTaskArgs decodes and validates task arguments
+func ParseTaskArgs(raw json.RawMessage) (TaskArgs, error) {
+	var args TaskArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return args, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Prompt) == "" {
+		return args, fmt.Errorf("prompt is required")
+	}
+	if args.Mode == "" {
+		args.Mode = "explore"
+	}
+	return args, nil
+}
+
+func (Task) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	if _, err := ParseTaskArgs(raw); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("task must be run by the agent")
+}
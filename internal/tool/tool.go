@@ -3,7 +3,10 @@ package tool
 import (
 	"context"
 	"encoding/json"
+	"slices"
 
+	"github.com/abcdlsj/otter/internal/diff"
+	"github.com/abcdlsj/otter/internal/types"
 	"github.com/tmc/langchaingo/llms"
 )
 
@@ -14,6 +17,41 @@ type Tool interface {
 	Run(ctx context.Context, args json.RawMessage) (string, error)
 }
 
+// Result is the structured outcome of a tool call
+type Result struct {
+	Output string
+	Diffs  []diff.File
+	Images []types.Image
+}
+
+// ResultRunner is implemented by tools that report more than text, such as
+// the diffs of the files they changed
+type ResultRunner interface {
+	RunResult(ctx context.Context, args json.RawMessage) (Result, error)
+}
+
+type visionKey struct{}
+
+// WithVision tells tools whether the model can be sent images
+func WithVision(ctx context.Context, vision bool) context.Context {
+	return context.WithValue(ctx, visionKey{}, vision)
+}
+
+// VisionFrom reports whether tools may return images
+func VisionFrom(ctx context.Context) bool {
+	v, _ := ctx.Value(visionKey{}).(bool)
+	return v
+}
+
+// Execute runs t, collecting a structured result when the tool provides one
+func Execute(ctx context.Context, t Tool, args json.RawMessage) (Result, error) {
+	if r, ok := t.(ResultRunner); ok {
+		return r.RunResult(ctx, args)
+	}
+	out, err := t.Run(ctx, args)
+	return Result{Output: out}, err
+}
+
 func ToLangchain(t Tool) llms.Tool {
 	return llms.Tool{
 		Type: "function",
@@ -25,6 +63,9 @@ func ToLangchain(t Tool) llms.Tool {
 	}
 }
 
+// ReadOnly names the tools that never change files or run commands
+var ReadOnly = []string{"view", "grep", "glob", "list", "lsp", "git", "webfetch", "websearch"}
+
 type Set struct {
 	tools map[string]Tool
 }
@@ -34,20 +75,24 @@ func NewSet() *Set {
 	s.Add(&Shell{})
 	s.Add(&File{})
 	s.Add(&Edit{})
+	s.Add(&MultiEdit{})
+	s.Add(&Patch{})
 	s.Add(&Grep{})
 	s.Add(&List{})
 	s.Add(&View{})
 	s.Add(&Glob{})
+	s.Add(&LSP{})
 	s.Add(&WebFetch{})
 	s.Add(&WebSearch{})
 	s.Add(&Git{})
 	s.Add(&Compact{})
+	s.Add(&Task{})
 	return s
 }
 
-func (s *Set) Add(t Tool)              { s.tools[t.Name()] = t }
-func (s *Set) Get(name string) Tool    { return s.tools[name] }
-func (s *Set) All() []Tool             {
+func (s *Set) Add(t Tool)           { s.tools[t.Name()] = t }
+func (s *Set) Get(name string) Tool { return s.tools[name] }
+func (s *Set) All() []Tool {
 	var ts []Tool
 	for _, t := range s.tools {
 		ts = append(ts, t)
@@ -55,6 +100,28 @@ func (s *Set) All() []Tool             {
 	return ts
 }
 
+// Subset returns a set with only the named tools. Unknown names are ignored.
+func (s *Set) Subset(names []string) *Set {
+	sub := &Set{tools: make(map[string]Tool)}
+	for _, name := range names {
+		if t, ok := s.tools[name]; ok {
+			sub.Add(t)
+		}
+	}
+	return sub
+}
+
+// Without returns a set with the named tools removed
+func (s *Set) Without(names ...string) *Set {
+	sub := &Set{tools: make(map[string]Tool)}
+	for name, t := range s.tools {
+		if !slices.Contains(names, name) {
+			sub.Add(t)
+		}
+	}
+	return sub
+}
+
 func (s *Set) ToLangchain() []llms.Tool {
 	var ts []llms.Tool
 	for _, t := range s.tools {
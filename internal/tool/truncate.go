@@ -0,0 +1,63 @@
+package tool
+
+import (
+	"strings"
+)
+
+// Budget bounds how much of a tool result is sent back to the model
+type Budget struct {
+	Tokens int
+	Count  func(string) int
+}
+
+// Truncator is implemented by tools that can shorten their own output
+// without breaking its structure. The result must fit within the budget.
+type Truncator interface {
+	Truncate(result string, b Budget) string
+}
+
+// Truncate shortens result to fit b, using the tool's own strategy if it has one
+func Truncate(t Tool, result string, b Budget) string {
+	if tr, ok := t.(Truncator); ok {
+		return tr.Truncate(result, b)
+	}
+	return TruncateLines(result, b)
+}
+
+// TruncateLines keeps whole lines from the top until the budget is spent.
+// A first line that does not fit on its own is cut at a rune boundary.
+func TruncateLines(s string, b Budget) string {
+	lines := strings.Split(s, "\n")
+	n := fitLines(lines, b.Tokens, b.Count)
+	if n == 0 {
+		return truncateTokens(lines[0], b)
+	}
+	return strings.Join(lines[:n], "\n")
+}
+
+// fitLines returns how many leading lines fit within tokens
+func fitLines(lines []string, tokens int, count func(string) int) int {
+	used := 0
+	for i, line := range lines {
+		used += count(line) + 1
+		if used > tokens {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// truncateTokens cuts s at the longest rune prefix that fits within b
+func truncateTokens(s string, b Budget) string {
+	r := []rune(s)
+	lo, hi := 0, len(r)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if b.Count(string(r[:mid])) <= b.Tokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return string(r[:lo])
+}
@@ -6,16 +6,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/media"
+	"github.com/abcdlsj/otter/internal/types"
 )
 
 type View struct{}
 
 func (View) Name() string { return "view" }
 func (View) Desc() string {
-	return "View file contents or directory structure. For files: displays content with line numbers. For directories: shows tree-like structure."
+	return "View file contents or directory structure. For files: displays content with line numbers. For directories: shows tree-like structure. For PNG, JPEG, GIF and WebP files: shows the image when the model supports images."
 }
 func (View) Args() map[string]any {
 	return map[string]any{
@@ -42,13 +45,18 @@ func (View) Args() map[string]any {
 }
 
 func (v View) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	res, err := v.RunResult(ctx, raw)
+	return res.Output, err
+}
+
+func (v View) RunResult(ctx context.Context, raw json.RawMessage) (Result, error) {
 	var args struct {
 		Path      string `json:"path"`
 		ViewRange []int  `json:"view_range"`
 		Depth     int    `json:"depth"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
-		return "", err
+		return Result{}, err
 	}
 
 	if args.Path == "" {
@@ -58,28 +66,50 @@ func (v View) Run(ctx context.Context, raw json.RawMessage) (string, error) {
 
 	cfg := &config.C
 	if !cfg.CheckReadPermission(args.Path) {
-		return "", fmt.Errorf("permission denied: cannot read %s", args.Path)
+		return Result{}, fmt.Errorf("permission denied: cannot read %s", args.Path)
 	}
 
 	info, err := os.Stat(args.Path)
 	if err != nil {
-		return "", fmt.Errorf("cannot access path: %w", err)
+		return Result{}, fmt.Errorf("cannot access path: %w", err)
 	}
 
-	if info.IsDir() {
+	var out string
+	switch {
+	case info.IsDir():
 		if args.Depth <= 0 {
 			args.Depth = 3
 		}
 		if args.Depth > 5 {
 			args.Depth = 5
 		}
-		return v.viewDir(ctx, args.Path, args.Depth, cfg)
+		out, err = v.viewDir(ctx, args.Path, args.Depth, cfg)
+	case media.IsImage(args.Path):
+		return v.viewImage(ctx, args.Path)
+	default:
+		out, err = v.viewFile(ctx, args.Path, args.ViewRange)
+	}
+	return Result{Output: out}, err
+}
+
+func (v View) viewImage(ctx context.Context, path string) (Result, error) {
+	if !VisionFrom(ctx) {
+		return Result{}, fmt.Errorf("%s is an image and the current model does not accept images", path)
+	}
+	img, err := media.LoadImage(path)
+	if err != nil {
+		return Result{}, err
+	}
+	label := media.Label(img)
+	// Sessions save images by path, so keep a copy that outlives the file
+	if stored, err := media.Store(img); err == nil {
+		img = stored
 	}
-	return v.viewFile(args.Path, args.ViewRange)
+	return Result{Output: "// Image: " + label, Images: []types.Image{img}}, nil
 }
 
-func (v View) viewFile(path string, viewRange []int) (string, error) {
-	content, err := os.ReadFile(path)
+func (v View) viewFile(ctx context.Context, path string, viewRange []int) (string, error) {
+	content, err := FSFrom(ctx).ReadFile(ctx, path)
 	if err != nil {
 		return "", fmt.Errorf("cannot read file: %w", err)
 	}
@@ -145,11 +175,11 @@ func (v View) viewDir(ctx context.Context, dir string, maxDepth int, cfg *config
 }
 
 type dirEntry struct {
-	name     string
-	path     string
-	isDir    bool
-	depth    int
-	skipped  bool
+	name    string
+	path    string
+	isDir   bool
+	depth   int
+	skipped bool
 }
 
 func (v View) collectEntries(ctx context.Context, dir string, depth, maxDepth int, cfg *config.Config) ([]string, error) {
@@ -217,3 +247,30 @@ func formatSize(n int64) string {
 		return fmt.Sprintf("%d B", n)
 	}
 }
+
+// Truncate keeps a contiguous range of numbered lines and reports it, so the
+// model can continue with view_range
+func (View) Truncate(result string, b Budget) string {
+	header, body, ok := strings.Cut(result, "\n")
+	if !ok || strings.HasPrefix(header, "// Directory:") {
+		return TruncateLines(result, b)
+	}
+	body, _, _ = strings.Cut(body, "\n\n[Showing lines")
+	lines := strings.Split(body, "\n")
+	n := fitLines(lines, b.Tokens-b.Count(header)-viewNoteTokens, b.Count)
+	if n == 0 {
+		return TruncateLines(result, b)
+	}
+	first, last := lineNumber(lines[0]), lineNumber(lines[n-1])
+	return header + "\n" + strings.Join(lines[:n], "\n") +
+		fmt.Sprintf("\n\n[Showing lines %d-%d. Use view_range starting at %d to read more]", first, last, last+1)
+}
+
+const viewNoteTokens = 32
+
+// lineNumber parses the line number prefix written by viewFile
+func lineNumber(line string) int {
+	num, _, _ := strings.Cut(line, "|")
+	n, _ := strconv.Atoi(strings.TrimSpace(num))
+	return n
+}
@@ -28,6 +28,10 @@ func (WebFetch) Args() map[string]any {
 				"type":        "number",
 				"description": "Maximum characters to return (truncates when exceeded, default 50000)",
 			},
+			"prompt": map[string]any{
+				"type":        "string",
+				"description": "What to find on the page. When set, a smaller model reads the page and returns only the answer instead of the full content",
+			},
 		},
 		"required": []string{"url"},
 	}
@@ -37,6 +41,7 @@ func (w WebFetch) Run(ctx context.Context, raw json.RawMessage) (string, error)
 	var args struct {
 		URL      string `json:"url"`
 		MaxChars int    `json:"maxChars"`
+		Prompt   string `json:"prompt"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
 		return "", err
@@ -94,9 +99,32 @@ func (w WebFetch) Run(ctx context.Context, raw json.RawMessage) (string, error)
 		content = content[:args.MaxChars] + "\n\n[Content truncated. Use maxChars parameter to get more.]"
 	}
 
+	if condense := CondenseFrom(ctx); condense != nil && args.Prompt != "" {
+		answer, err := condense(ctx, args.Prompt, content)
+		if err == nil {
+			return answer, nil
+		}
+		content = fmt.Sprintf("[Condensing failed: %v. Full content follows.]\n\n%s", err, content)
+	}
 	return content, nil
 }
 
+// Condense answers prompt from content, for tools that fetch more than
+// the model needs to read
+type Condense func(ctx context.Context, prompt, content string) (string, error)
+
+type condenseKey struct{}
+
+// WithCondense makes tools given a prompt condense their output with fn
+func WithCondense(ctx context.Context, fn Condense) context.Context {
+	return context.WithValue(ctx, condenseKey{}, fn)
+}
+
+func CondenseFrom(ctx context.Context) Condense {
+	fn, _ := ctx.Value(condenseKey{}).(Condense)
+	return fn
+}
+
 // extractText performs simple HTML to text extraction
 func extractText(html string) string {
 	// Remove script and style tags with their content
@@ -200,3 +228,56 @@ func removeTag(html, tag string) string {
 
 	return html
 }
+
+// Truncate keeps whole sections (split at headings) in page order and lists
+// the headings of the ones that were left out
+func (WebFetch) Truncate(result string, b Budget) string {
+	sections := splitSections(result)
+	budget := b.Tokens - webfetchNoteTokens
+
+	var kept strings.Builder
+	var omitted []string
+	used := 0
+	for _, sec := range sections {
+		n := b.Count(sec)
+		if used+n <= budget {
+			kept.WriteString(sec)
+			used += n
+			continue
+		}
+		if kept.Len() == 0 {
+			// The first section alone is too large, keep what fits of it
+			part := TruncateLines(sec, Budget{Tokens: budget, Count: b.Count})
+			kept.WriteString(part)
+			used += b.Count(part)
+			continue
+		}
+		heading, _, _ := strings.Cut(strings.TrimSpace(sec), "\n")
+		if strings.HasPrefix(heading, "# ") {
+			omitted = append(omitted, heading)
+		}
+	}
+
+	out := strings.TrimRight(kept.String(), "\n")
+	if len(omitted) > 0 {
+		note := "\n\n[Omitted sections: " + strings.Join(omitted, " | ") + "]"
+		note = truncateTokens(note, Budget{Tokens: webfetchNoteTokens, Count: b.Count})
+		out += note
+	}
+	return out
+}
+
+const webfetchNoteTokens = 64
+
+// splitSections splits extracted text before each "# " heading line
+func splitSections(text string) []string {
+	var sections []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if i > start && text[i] == '#' && text[i-1] == '\n' && strings.HasPrefix(text[i:], "# ") {
+			sections = append(sections, text[start:i])
+			start = i
+		}
+	}
+	return append(sections, text[start:])
+}
@@ -0,0 +1,231 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/abcdlsj/otter/internal/attach"
+	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/media"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const (
+	maxCompletions   = 8
+	fileListLifetime = 5 * time.Second
+)
+
+// attachMsg delivers a mention resolved in the background
+type attachMsg struct {
+	ref string
+	att types.Attachment
+	err error
+}
+
+type attachState struct {
+	att     types.Attachment
+	err     error
+	pending bool
+}
+
+type imageState struct {
+	img types.Image
+	err error
+}
+
+// completion is the state of @ completion while Tab is pressed repeatedly
+type completion struct {
+	matches []string
+	idx     int
+}
+
+func resolveAttachCmd(ref string) tea.Cmd {
+	return func() tea.Msg {
+		a, err := attach.Resolve(context.Background(), ref)
+		return attachMsg{ref: ref, att: a, err: err}
+	}
+}
+
+// completeMention completes the @mention being typed at the end of the
+// input from the workspace files, cycling through candidates on repeated
+// Tab. It reports false when the input doesn't end in a mention.
+func (m *Model) completeMention() bool {
+	value := m.input.Value()
+	start := strings.LastIndexAny(value, " \t\n") + 1
+	word := value[start:]
+	if !strings.HasPrefix(word, "@") || attach.IsURL(word[1:]) {
+		return false
+	}
+
+	c := m.completion
+	if c != nil && len(c.matches) > 1 && word == "@"+c.matches[c.idx] {
+		c.idx = (c.idx + 1) % len(c.matches)
+	} else {
+		matches := attach.Find(word[1:], m.fileCandidates(), maxCompletions)
+		if len(matches) == 0 {
+			m.completion = nil
+			return true
+		}
+		c = &completion{matches: matches}
+		m.completion = c
+	}
+	m.input.SetValue(value[:start] + "@" + c.matches[c.idx])
+	return true
+}
+
+func (m *Model) fileCandidates() []string {
+	if m.files == nil || time.Since(m.filesAt) > fileListLifetime {
+		m.files = attach.Candidates(attach.Files("."))
+		m.filesAt = time.Now()
+	}
+	return m.files
+}
+
+// refreshAttachments resolves new mentions in the input so their token cost
+// can be shown. Local ones are read right away; URLs are fetched in the
+// background once the mention is followed by a space.
+func (m *Model) refreshAttachments() tea.Cmd {
+	value := m.input.Value()
+	refs := attach.Mentions(value)
+	live := make(map[string]bool, len(refs))
+	var cmds []tea.Cmd
+	for _, ref := range refs {
+		live[ref] = true
+		if _, ok := m.attachments[ref]; ok {
+			continue
+		}
+		if attach.IsURL(ref) {
+			if strings.HasSuffix(value, ref) {
+				continue // still being typed
+			}
+			m.attachments[ref] = attachState{pending: true}
+			cmds = append(cmds, resolveAttachCmd(ref))
+			continue
+		}
+		a, err := attach.Resolve(context.Background(), ref)
+		m.attachments[ref] = attachState{att: a, err: err}
+	}
+	for ref := range m.attachments {
+		if !live[ref] {
+			delete(m.attachments, ref)
+		}
+	}
+
+	paths := attach.ImagePaths(value)
+	for _, path := range paths {
+		if _, ok := m.images[path]; !ok {
+			img, err := media.LoadImage(path)
+			m.images[path] = imageState{img: img, err: err}
+		}
+	}
+	for path := range m.images {
+		if !slices.Contains(paths, path) {
+			delete(m.images, path)
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// collectImages loads the images referenced in text. Ones that fail to
+// load are reported in the status line and left out.
+func (m *Model) collectImages(text string) []types.Image {
+	var images []types.Image
+	for _, path := range attach.ImagePaths(text) {
+		st, ok := m.images[path]
+		if !ok {
+			st.img, st.err = media.LoadImage(path)
+		}
+		if st.err == nil {
+			images = append(images, st.img)
+		}
+	}
+	return images
+}
+
+// collectAttachments resolves the mentions in text for sending. It may
+// fetch URLs, so it runs outside Update. Local files are read again in case
+// they changed; URLs fetched while typing are reused. Mentions that don't
+// resolve stay plain text.
+func collectAttachments(ctx context.Context, text string, fetched map[string]attachState) []types.Attachment {
+	var atts []types.Attachment
+	for _, ref := range attach.Mentions(text) {
+		if st, ok := fetched[ref]; ok && attach.IsURL(ref) && !st.pending {
+			if st.err == nil {
+				atts = append(atts, st.att)
+			}
+			continue
+		}
+		if a, err := attach.Resolve(ctx, ref); err == nil {
+			atts = append(atts, a)
+		}
+	}
+	return atts
+}
+
+// attachmentLine shows completion candidates, or the mentions in the input
+// with their token cost
+func (m *Model) attachmentLine() string {
+	muted := lipgloss.NewStyle().Foreground(fgMuted)
+	if m.completion != nil {
+		var parts []string
+		for i, c := range m.completion.matches {
+			if i == m.completion.idx {
+				parts = append(parts, lipgloss.NewStyle().Foreground(secondary).Render(c))
+			} else {
+				parts = append(parts, muted.Render(c))
+			}
+		}
+		return " " + strings.Join(parts, "  ")
+	}
+
+	var parts []string
+	var total int64
+	for _, path := range attach.ImagePaths(m.input.Value()) {
+		st, ok := m.images[path]
+		switch {
+		case !ok:
+			continue
+		case st.err != nil:
+			parts = append(parts, lipgloss.NewStyle().Foreground(errColor).Render(st.err.Error()))
+		default:
+			tokens := llm.EstimateImageTokens(st.img)
+			total += tokens
+			parts = append(parts, muted.Render(fmt.Sprintf("▣ %s ~%d", media.Label(st.img), tokens)))
+		}
+	}
+	for _, ref := range attach.Mentions(m.input.Value()) {
+		st, ok := m.attachments[ref]
+		switch {
+		case !ok:
+			continue
+		case st.pending:
+			parts = append(parts, muted.Render("@"+ref+" (fetching…)"))
+		case st.err != nil:
+			parts = append(parts, lipgloss.NewStyle().Foreground(errColor).Render("@"+ref+": "+st.err.Error()))
+		default:
+			total += st.att.Tokens
+			parts = append(parts, muted.Render(fmt.Sprintf("@%s ~%d", attach.Label(st.att), st.att.Tokens)))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, muted.Render(" · ")) + muted.Render(fmt.Sprintf("  (~%d tokens attached)", total))
+}
+
+func renderAttachments(sb *strings.Builder, atts []types.Attachment, images []types.Image) {
+	for _, img := range images {
+		sb.WriteString(lipgloss.NewStyle().Foreground(fgSubtle).Render("  ▣ " + media.Label(img)))
+		sb.WriteString("\n")
+	}
+	for _, a := range atts {
+		sb.WriteString(lipgloss.NewStyle().Foreground(fgSubtle).Render(fmt.Sprintf("  @ %s (~%d tokens)", attach.Label(a), a.Tokens)))
+		sb.WriteString("\n")
+	}
+}
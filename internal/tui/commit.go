@@ -0,0 +1,77 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/msg"
+	"github.com/abcdlsj/otter/internal/types"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// commitMsg reports the end of /commit
+type commitMsg struct {
+	session string
+	usage   types.Usage // zero when no message was written
+	message string
+	output  string // git's output
+	err     error
+}
+
+// cmdCommit commits the staged changes with a message written by the small
+// model, following the instructions after /commit if any
+func (m *Model) cmdCommit(text string) tea.Cmd {
+	_, hint, _ := strings.Cut(text, " ")
+	a, sid := m.agent, m.session
+	lg := logger.NewFileLogger(logger.SessionLogDir(m.sessionsDir, m.session))
+	m.addSystemMsg("Writing a commit message for the staged changes...")
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		diff, err := exec.CommandContext(ctx, "git", "diff", "--cached").Output()
+		if err != nil {
+			return commitMsg{session: sid, err: fmt.Errorf("git diff --cached: %w", err)}
+		}
+		if len(bytes.TrimSpace(diff)) == 0 {
+			return commitMsg{session: sid, err: errors.New("nothing staged: git add the changes to commit first")}
+		}
+		message, usage, err := a.CommitMessage(ctx, lg, string(diff), strings.TrimSpace(hint))
+		if err != nil {
+			return commitMsg{session: sid, err: err}
+		}
+		res := commitMsg{session: sid, usage: usage, message: message}
+		cmd := exec.CommandContext(ctx, "git", "commit", "-F", "-")
+		cmd.Stdin = strings.NewReader(message + "\n")
+		out, err := cmd.CombinedOutput()
+		res.output = strings.TrimSpace(string(out))
+		if err != nil {
+			res.err = fmt.Errorf("git commit: %w", err)
+		}
+		return res
+	}
+}
+
+func (m *Model) commitDone(res commitMsg) {
+	if res.usage.Model != "" {
+		m.addUsage(res.usage)
+		subject, _, _ := strings.Cut(res.message, "\n")
+		m.bus.GetOrCreateSession(res.session)
+		m.bus.Pub(msg.UsageNote(res.session, "[commit] "+subject, res.usage))
+	}
+	switch {
+	case res.err != nil && res.message == "":
+		m.addErrorMsg("Commit failed: " + res.err.Error())
+	case res.err != nil:
+		m.addErrorMsg(fmt.Sprintf("Commit failed: %v\n%s\n\nMessage:\n%s", res.err, res.output, res.message))
+	default:
+		summary, _, _ := strings.Cut(res.output, "\n")
+		m.addSystemMsg(fmt.Sprintf("%s\n\n%s", summary, res.message))
+	}
+	m.updateViewport()
+}
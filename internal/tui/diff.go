@@ -0,0 +1,208 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/abcdlsj/otter/internal/diff"
+)
+
+const maxCollapsedDiffLines = 12
+
+var (
+	diffAddBg  = lipgloss.Color("#1F3A1F")
+	diffDelBg  = lipgloss.Color("#3F1F1F")
+	diffSyntax = styles.Get("monokai")
+)
+
+// renderDiffs draws file diffs unified or side by side. Collapsed diffs stop
+// after maxCollapsedDiffLines rows. Renders are cached per tool call and
+// width; the cache is cleared whenever the layout or the messages change.
+func (m *Model) renderDiffs(sb *strings.Builder, id string, files []diff.File) {
+	key := fmt.Sprintf("%s:%d", id, m.width)
+	if cached, ok := m.diffCache[key]; ok && id != "" {
+		sb.WriteString(cached)
+		return
+	}
+
+	var out strings.Builder
+	var rows []string
+	for _, f := range files {
+		rows = append(rows, m.diffHeader(f))
+		lexer := diffLexer(f.Path)
+		for _, h := range f.Hunks {
+			rows = append(rows, lipgloss.NewStyle().Foreground(fgSubtle).Render(
+				fmt.Sprintf("    @@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)))
+			if m.diffSplit {
+				rows = append(rows, m.splitRows(lexer, h)...)
+			} else {
+				rows = append(rows, m.unifiedRows(lexer, h)...)
+			}
+		}
+	}
+
+	shown := rows
+	if !m.diffExpanded && len(rows) > maxCollapsedDiffLines {
+		shown = rows[:maxCollapsedDiffLines]
+	}
+	for _, r := range shown {
+		out.WriteString(r)
+		out.WriteString("\n")
+	}
+	if hidden := len(rows) - len(shown); hidden > 0 {
+		out.WriteString(lipgloss.NewStyle().Foreground(fgMuted).Render(
+			fmt.Sprintf("    ... %d more diff lines (Ctrl+O to expand)", hidden)))
+		out.WriteString("\n")
+	}
+
+	if id != "" {
+		m.diffCache[key] = out.String()
+	}
+	sb.WriteString(out.String())
+}
+
+func (m *Model) diffHeader(f diff.File) string {
+	return "    " + lipgloss.NewStyle().Foreground(primary).Render(f.Path) + " " +
+		lipgloss.NewStyle().Foreground(success).Render(fmt.Sprintf("+%d", f.Added)) + " " +
+		lipgloss.NewStyle().Foreground(errColor).Render(fmt.Sprintf("-%d", f.Removed))
+}
+
+func (m *Model) unifiedRows(lexer chroma.Lexer, h diff.Hunk) []string {
+	width := max(m.width-16, 20)
+	var rows []string
+	oldNo, newNo := h.OldStart, h.NewStart
+	for _, l := range h.Lines {
+		var o, n string
+		switch l.Kind {
+		case diff.Equal:
+			o, n = fmt.Sprint(oldNo), fmt.Sprint(newNo)
+			oldNo++
+			newNo++
+		case diff.Delete:
+			o = fmt.Sprint(oldNo)
+			oldNo++
+		case diff.Insert:
+			n = fmt.Sprint(newNo)
+			newNo++
+		}
+		gutter := lipgloss.NewStyle().Foreground(fgSubtle).Render(fmt.Sprintf("    %4s %4s ", o, n))
+		rows = append(rows, gutter+diffCell(lexer, l, width))
+	}
+	return rows
+}
+
+// splitRows pairs removed lines with the added lines that replace them
+func (m *Model) splitRows(lexer chroma.Lexer, h diff.Hunk) []string {
+	half := max((m.width-8)/2-6, 20)
+	var rows []string
+	oldNo, newNo := h.OldStart, h.NewStart
+
+	row := func(left, right *diff.Line) {
+		l, r := strings.Repeat(" ", half+5), strings.Repeat(" ", half+5)
+		if left != nil {
+			l = lipgloss.NewStyle().Foreground(fgSubtle).Render(fmt.Sprintf("%4d ", oldNo)) + diffCell(lexer, *left, half)
+			oldNo++
+		}
+		if right != nil {
+			r = lipgloss.NewStyle().Foreground(fgSubtle).Render(fmt.Sprintf("%4d ", newNo)) + diffCell(lexer, *right, half)
+			newNo++
+		}
+		rows = append(rows, "    "+l+lipgloss.NewStyle().Foreground(fgSubtle).Render("│")+r)
+	}
+
+	lines := h.Lines
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == diff.Equal {
+			row(&lines[i], &lines[i])
+			i++
+			continue
+		}
+		var dels, adds []diff.Line
+		for ; i < len(lines) && lines[i].Kind == diff.Delete; i++ {
+			dels = append(dels, lines[i])
+		}
+		for ; i < len(lines) && lines[i].Kind == diff.Insert; i++ {
+			adds = append(adds, lines[i])
+		}
+		for j := 0; j < max(len(dels), len(adds)); j++ {
+			var left, right *diff.Line
+			if j < len(dels) {
+				left = &dels[j]
+			}
+			if j < len(adds) {
+				right = &adds[j]
+			}
+			row(left, right)
+		}
+	}
+	return rows
+}
+
+// diffCell renders one diff line: sign, syntax-highlighted code and a
+// background for added/removed lines, padded to width
+func diffCell(lexer chroma.Lexer, l diff.Line, width int) string {
+	var bg lipgloss.Color
+	sign := lipgloss.NewStyle().Foreground(fgSubtle)
+	switch l.Kind {
+	case diff.Insert:
+		bg = diffAddBg
+		sign = sign.Foreground(success).Background(bg)
+	case diff.Delete:
+		bg = diffDelBg
+		sign = sign.Foreground(errColor).Background(bg)
+	}
+
+	code := strings.ReplaceAll(l.Text, "\t", "    ")
+	if r := []rune(code); len(r) > width-2 {
+		code = string(r[:max(width-3, 0)]) + "…"
+	}
+	pad := max(width-1-lipgloss.Width(code), 0)
+
+	var b strings.Builder
+	b.WriteString(sign.Render(string(l.Kind)))
+	b.WriteString(highlight(lexer, code, bg))
+	b.WriteString(lipgloss.NewStyle().Background(bg).Render(strings.Repeat(" ", pad)))
+	return b.String()
+}
+
+func diffLexer(path string) chroma.Lexer {
+	lexer := lexers.Match(filepath.Base(path))
+	if lexer == nil {
+		return nil
+	}
+	return chroma.Coalesce(lexer)
+}
+
+func highlight(lexer chroma.Lexer, code string, bg lipgloss.Color) string {
+	base := lipgloss.NewStyle().Foreground(fgBase)
+	if bg != "" {
+		base = base.Background(bg)
+	}
+	if lexer == nil {
+		return base.Render(code)
+	}
+	it, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return base.Render(code)
+	}
+
+	var b strings.Builder
+	for _, tok := range it.Tokens() {
+		text := strings.TrimRight(tok.Value, "\n")
+		if text == "" {
+			continue
+		}
+		st := base
+		if e := diffSyntax.Get(tok.Type); e.Colour.IsSet() {
+			st = st.Foreground(lipgloss.Color(e.Colour.String()))
+		}
+		b.WriteString(st.Render(text))
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/abcdlsj/otter/internal/attach"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const maxQueueDisplay = 60
+
+// enqueue holds a message typed while the agent is running; the agent picks
+// it up between steps. Commands other than /queue have to wait.
+func (m *Model) enqueue(text string) {
+	if strings.HasPrefix(text, "/") {
+		if name, _, _ := strings.Cut(text, " "); name == "/queue" {
+			m.handleCommand(text)
+			return
+		}
+		m.addErrorMsg("Commands can't run while the agent is working. Wait for it to finish or press Ctrl+C.")
+		m.updateViewport()
+		return
+	}
+	m.queue.Push(text)
+	if len(attach.Mentions(text)) > 0 || len(attach.ImagePaths(text)) > 0 {
+		m.addSystemMsg("Queued. If the agent picks it up mid-turn, its @mentions and images are sent as plain text, not attached.")
+		m.updateViewport()
+	}
+	m.input.Reset()
+	m.completion = nil
+	clear(m.attachments)
+	clear(m.images)
+}
+
+// unqueue moves queued messages back into the input when a run stops early,
+// so they aren't lost or sent without the user noticing
+func (m *Model) unqueue() {
+	queued := m.queue.Drain()
+	if len(queued) == 0 {
+		return
+	}
+	if cur := strings.TrimSpace(m.input.Value()); cur != "" {
+		queued = append(queued, cur)
+	}
+	m.input.SetValue(strings.Join(queued, "\n\n"))
+}
+
+func (m *Model) cmdQueue(parts []string) {
+	if len(parts) > 1 && parts[1] == "clear" {
+		m.queue.Drain()
+		m.addSystemMsg("Queue cleared")
+		return
+	}
+	items := m.queue.Items()
+	if len(items) == 0 {
+		m.addSystemMsg("No queued messages. Press Enter while the agent is running to queue one.")
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("Queued messages:\n")
+	for i, text := range items {
+		fmt.Fprintf(&sb, "  %d. %s\n", i+1, text)
+	}
+	sb.WriteString("Up on an empty input edits the last one; /queue clear drops them all.")
+	m.addSystemMsg(sb.String())
+}
+
+// queueLines shows the queued messages above the input
+func (m *Model) queueLines() []string {
+	var lines []string
+	for _, text := range m.queue.Items() {
+		first, _, more := strings.Cut(text, "\n")
+		short := types.TruncateRunes(first, maxQueueDisplay)
+		if more || len(short) < len(first) {
+			short += "…"
+		}
+		lines = append(lines, " "+lipgloss.NewStyle().Foreground(fgSubtle).Render("⏵ queued: ")+
+			lipgloss.NewStyle().Foreground(fgMuted).Render(short))
+	}
+	return lines
+}
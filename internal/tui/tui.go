@@ -3,6 +3,9 @@ package tui
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,11 +17,17 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/abcdlsj/otter/internal/agent"
+	"github.com/abcdlsj/otter/internal/attach"
+	"github.com/abcdlsj/otter/internal/command"
 	"github.com/abcdlsj/otter/internal/config"
+	"github.com/abcdlsj/otter/internal/diff"
 	"github.com/abcdlsj/otter/internal/event"
 	"github.com/abcdlsj/otter/internal/llm"
 	"github.com/abcdlsj/otter/internal/logger"
+	"github.com/abcdlsj/otter/internal/media"
+	"github.com/abcdlsj/otter/internal/mode"
 	"github.com/abcdlsj/otter/internal/msg"
+	"github.com/abcdlsj/otter/internal/prompt"
 	"github.com/abcdlsj/otter/internal/tool"
 	"github.com/abcdlsj/otter/internal/types"
 )
@@ -32,6 +41,12 @@ type message struct {
 	role    string
 	content string
 	args    string
+	diffs   []diff.File
+	id      string // tool call ID
+	parent  string // task call ID for sub-agent tool calls
+
+	attachments []types.Attachment
+	images      []types.Image
 }
 
 type Model struct {
@@ -43,7 +58,7 @@ type Model struct {
 	spinner  spinner.Model
 	messages []message
 
-	inputTokens  int64
+	inputTokens  int64 // all calls since Otter started, counted as they finish
 	outputTokens int64
 
 	sessionsDir string
@@ -53,9 +68,20 @@ type Model struct {
 	autoScroll  bool
 	cancel      context.CancelFunc
 	events      <-chan event.Event
+	queue       *agent.Queue // messages typed while the agent is running
 
 	mdRenderer *glamour.TermRenderer
 
+	diffExpanded bool
+	diffSplit    bool
+	diffCache    map[string]string
+
+	attachments map[string]attachState // @mentions in the input by ref
+	images      map[string]imageState  // image paths in the input
+	completion  *completion
+	files       []string
+	filesAt     time.Time
+
 	width  int
 	height int
 	ready  bool
@@ -82,32 +108,80 @@ func New(a *agent.Agent, t *tool.Set, b *msg.Bus) Model {
 		input:       ta,
 		spinner:     sp,
 		sessionsDir: config.SessionsDir(),
-		session:     newSessionID(),
+		session:     msg.NewSessionID(),
 		autoScroll:  true,
+		diffCache:   make(map[string]string),
+		attachments: make(map[string]attachState),
+		images:      make(map[string]imageState),
+		queue:       agent.NewQueue(),
 	}
 }
 
-func newSessionID() string {
-	now := time.Now()
-	return fmt.Sprintf("%s_%03d", now.Format("20060102_150405"), now.Nanosecond()/1000000)
-}
-
 func (m *Model) cycleMode() {
-	modes := []string{"default", "plan", "explore"}
-	cur := m.agent.Mode()
-	next := "default"
-	for i, mode := range modes {
-		if mode == cur {
+	modes := mode.All()
+	cur := m.agent.Mode().Name
+	next := modes[0]
+	for i, md := range modes {
+		if md.Name == cur {
 			next = modes[(i+1)%len(modes)]
 			break
 		}
 	}
-	m.agent.SetMode(next)
+	m.setMode(next)
+	m.updateViewport()
+}
+
+// builtinCommands are handled by handleCommand or send; custom commands
+// with the same name are shadowed
+var builtinCommands = []string{"/new", "/clear", "/sessions", "/switch", "/resume", "/continue", "/models", "/model", "/mode", "/compact", "/diff", "/init", "/queue", "/usage", "/commit", "/help"}
+
+// completeCommand completes a slash command name in the input, listing the
+// candidates when more than one matches
+func (m *Model) completeCommand() {
+	value := m.input.Value()
+	if strings.ContainsAny(value, " \n") {
+		return
+	}
+	var matches []string
+	for _, name := range builtinCommands {
+		if strings.HasPrefix(name, value) {
+			matches = append(matches, name)
+		}
+	}
+	for _, c := range command.All() {
+		name := "/" + c.Name
+		if strings.HasPrefix(name, value) && !slices.Contains(matches, name) {
+			matches = append(matches, name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return
+	case 1:
+		m.input.SetValue(matches[0] + " ")
+		return
+	}
+	prefix := matches[0]
+	for _, name := range matches[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(prefix) > len(value) {
+		m.input.SetValue(prefix)
+		return
+	}
+	m.addSystemMsg(strings.Join(matches, "  "))
+	m.updateViewport()
+}
+
+func (m *Model) setMode(md mode.Mode) {
+	m.agent.SetMode(md)
 	m.messages = append(m.messages, message{
 		role:    "system",
-		content: fmt.Sprintf("Switched to %s mode", next),
+		content: fmt.Sprintf("Switched to %s mode", md.Name),
 	})
-	m.updateViewport()
 }
 
 func (m Model) Init() tea.Cmd {
@@ -115,13 +189,26 @@ func (m Model) Init() tea.Cmd {
 }
 
 type eventMsg event.Event
-type titleMsg struct{}
+type titleMsg struct {
+	usage types.Usage
+}
+type runEndMsg struct{} // the agent closed its event channel
+
+// preparedMsg carries a user message whose command prompt has been expanded
+// or whose mentions have been resolved off the UI loop, ready to start the turn
+type preparedMsg struct {
+	ctx    context.Context // cancelled when the user pressed Ctrl+C meanwhile
+	index  int             // of the message in m.messages, to show its attachments
+	input  string
+	atts   []types.Attachment
+	images []types.Image
+}
 
 func generateTitleCmd(a *agent.Agent, bus *msg.Bus, sid string, lg logger.Logger, text string) tea.Cmd {
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
-		title, err := a.GenerateTitle(ctx, lg, text)
+		title, usage, err := a.GenerateTitle(ctx, lg, text)
 		if err != nil {
 			lg.Warn("generate title failed", "err", err)
 			return nil
@@ -129,7 +216,8 @@ func generateTitleCmd(a *agent.Agent, bus *msg.Bus, sid string, lg logger.Logger
 		if title != "" {
 			bus.SetSessionTitle(sid, title)
 		}
-		return titleMsg{}
+		bus.Pub(msg.UsageNote(sid, "[title] "+title, usage))
+		return titleMsg{usage: usage}
 	}
 }
 
@@ -137,8 +225,7 @@ func waitForEvent(ch <-chan event.Event) tea.Cmd {
 	return func() tea.Msg {
 		ev, ok := <-ch
 		if !ok {
-			// Channel closed, agent finished
-			return nil
+			return runEndMsg{}
 		}
 		return eventMsg(ev)
 	}
@@ -149,30 +236,41 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if msg.String() != "tab" {
+			m.completion = nil
+		}
 		switch msg.String() {
 		case "ctrl+c":
 			if m.thinking && m.cancel != nil {
 				m.cancel()
 				m.thinking = false
 				m.toolName = ""
+				m.unqueue()
+				if m.events == nil {
+					// Still preparing the message, so no turn was started
+					m.addSystemMsg("Cancelled.")
+				} else {
+					m.addSystemMsg("Cancelled. Use /resume to continue the turn.")
+				}
+				m.updateViewport()
 				return m, nil
 			}
 			return m, tea.Quit
 
 		case "enter":
-			if m.thinking {
-				return m, nil
-			}
 			text := strings.TrimSpace(m.input.Value())
 			if text == "" {
 				return m, nil
 			}
+			// A cancelled run may still be saving its last steps
+			if m.thinking || m.events != nil {
+				m.enqueue(text)
+				return m, nil
+			}
 			return m.send(text)
 
 		case "ctrl+j":
-			if !m.thinking {
-				m.input.InsertString("\n")
-			}
+			m.input.InsertString("\n")
 			return m, nil
 
 		case "ctrl+s":
@@ -187,13 +285,35 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 
+		case "ctrl+o":
+			m.diffExpanded = !m.diffExpanded
+			clear(m.diffCache)
+			m.updateViewport()
+			return m, nil
+
 		case "tab":
-			if !m.thinking {
+			switch {
+			case m.completeMention():
+				return m, m.refreshAttachments()
+			case m.thinking:
+			case strings.HasPrefix(m.input.Value(), "/"):
+				m.completeCommand()
+			default:
 				m.cycleMode()
 			}
 			return m, nil
 
-		case "pgup", "pgdown", "up", "down":
+		case "up":
+			// Up on an empty input takes the last queued message back for editing
+			if m.input.Value() == "" {
+				if text, ok := m.queue.Pop(); ok {
+					m.input.SetValue(text)
+					return m, nil
+				}
+			}
+			fallthrough
+
+		case "pgup", "pgdown", "down":
 			var cmd tea.Cmd
 			m.viewport, cmd = m.viewport.Update(msg)
 			m.autoScroll = m.viewport.AtBottom()
@@ -211,6 +331,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		clear(m.diffCache)
 
 		headerHeight := 1
 		footerHeight := 2
@@ -241,16 +362,52 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case titleMsg:
+		m.addUsage(msg.usage)
+		return m, nil
+
+	case commitMsg:
+		m.commitDone(msg)
 		return m, nil
 
+	case attachMsg:
+		if _, ok := m.attachments[msg.ref]; ok {
+			m.attachments[msg.ref] = attachState{att: msg.att, err: msg.err}
+		}
+		return m, nil
+
+	case preparedMsg:
+		if msg.ctx.Err() != nil {
+			return m, nil
+		}
+		m.cancel()
+		if msg.index < len(m.messages) {
+			m.messages[msg.index].attachments = msg.atts
+		}
+		return m.run(msg.input, msg.atts, msg.images, 0)
+
 	case eventMsg:
 		return m.handleEvent(event.Event(msg))
+
+	case runEndMsg:
+		m.events = nil
+		// Messages queued after the agent's last check start the next turn
+		if queued := m.queue.Drain(); len(queued) > 0 && !m.thinking {
+			typing := m.input.Value()
+			model, cmd := m.send(strings.Join(queued, "\n\n"))
+			next := model.(Model)
+			next.input.SetValue(typing)
+			return next, cmd
+		}
+		return m, nil
 	}
 
-	if !m.thinking && m.ready {
+	if m.ready {
 		var cmd tea.Cmd
 		m.input, cmd = m.input.Update(msg)
 		cmds = append(cmds, cmd)
+		if _, ok := msg.(tea.KeyMsg); ok {
+			cmds = append(cmds, m.refreshAttachments())
+		}
 	}
 
 	return m, tea.Batch(cmds...)
@@ -261,8 +418,87 @@ func (m Model) send(text string) (tea.Model, tea.Cmd) {
 		return m, cmd
 	}
 
-	m.messages = append(m.messages, message{role: "user", content: text})
+	if text == "/resume" {
+		return m.resume(0)
+	}
+	if name, arg, _ := strings.Cut(text, " "); name == "/continue" {
+		steps := 0
+		if arg = strings.TrimSpace(arg); arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				m.addErrorMsg("Usage: /continue [steps]")
+				m.updateViewport()
+				return m, nil
+			}
+			steps = n
+		}
+		return m.resume(steps)
+	}
+
+	// /init and custom commands are shown as typed but send the agent the
+	// full prompt
+	var expand func(ctx context.Context) string
+	if text == "/init" {
+		expand = func(context.Context) string { return prompt.InitPrompt }
+	} else if name, args, _ := strings.Cut(text, " "); strings.HasPrefix(name, "/") {
+		if c, ok := command.Find(name); ok {
+			expand = func(ctx context.Context) string { return c.Expand(ctx, args) }
+		}
+	}
+
+	// @mentions become attachments, except in command prompts, which
+	// expand their own
+	var images []types.Image
+	if expand == nil {
+		images = m.collectImages(text)
+	}
+	if len(images) > 0 {
+		if err := m.agent.CheckImages(); err != nil {
+			m.addErrorMsg(err.Error())
+			m.updateViewport()
+			return m, nil
+		}
+		for i, img := range images {
+			if stored, err := media.Store(img); err == nil {
+				images[i] = stored
+			}
+		}
+	}
+
+	fetched := maps.Clone(m.attachments)
+	m.messages = append(m.messages, message{role: "user", content: text, images: images})
 	m.input.Reset()
+	clear(m.attachments)
+	clear(m.images)
+	if expand == nil && len(attach.Mentions(text)) == 0 {
+		return m.run(text, nil, images, 0)
+	}
+
+	// Commands can run shell snippets for up to 30 seconds each and mentions
+	// may fetch URLs, so the message is prepared in the background; Ctrl+C
+	// drops it
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.thinking = true
+	m.autoScroll = true
+	m.updateViewport()
+	index := len(m.messages) - 1
+	prepare := func() tea.Msg {
+		p := preparedMsg{ctx: ctx, index: index, input: text, images: images}
+		if expand != nil {
+			p.input = expand(ctx)
+		} else {
+			p.atts = collectAttachments(ctx, text, fetched)
+		}
+		return p
+	}
+	return m, tea.Batch(m.spinner.Tick, prepare)
+}
+
+// run starts the agent after the session's history. An empty input resumes
+// the last turn instead of adding a user message; steps overrides the
+// mode's step budget when set.
+func (m Model) run(input string, atts []types.Attachment, images []types.Image, steps int) (tea.Model, tea.Cmd) {
 	m.thinking = true
 	m.autoScroll = true
 	m.updateViewport()
@@ -270,36 +506,61 @@ func (m Model) send(text string) (tea.Model, tea.Cmd) {
 	session := m.bus.GetOrCreateSession(m.session)
 	isFirstMessage := len(session.Messages) == 0
 
-	history := msgsToLLM(session.Messages)
+	history := msg.ToLLM(session.Messages)
 
-	m.bus.Pub(msg.User(m.session, text))
+	if input != "" {
+		user := msg.User(m.session, input)
+		user.Attachments = atts
+		user.Images = images
+		m.bus.Pub(user)
+	}
 
 	lg := logger.NewFileLogger(logger.SessionLogDir(m.sessionsDir, m.session))
 
 	ctx, cancel := context.WithCancel(context.Background())
 	m.cancel = cancel
-	rawEvents := m.agent.Run(ctx, lg, history, text)
+	rawEvents := m.agent.Run(ctx, lg, history, attach.Content(input, atts), images, agent.Options{Queue: m.queue, MaxSteps: steps})
 	m.events = m.bus.HandleEvents(m.session, rawEvents)
 
 	cmds := []tea.Cmd{m.spinner.Tick, waitForEvent(m.events)}
 	if isFirstMessage {
-		cmds = append(cmds, generateTitleCmd(m.agent, m.bus, m.session, lg, text))
+		cmds = append(cmds, generateTitleCmd(m.agent, m.bus, m.session, lg, input))
 	}
 	return m, tea.Batch(cmds...)
 }
 
+// resume continues a turn that was paused, cancelled, failed or cut short
+// by an exit, for steps more steps or the mode's usual budget
+func (m Model) resume(steps int) (tea.Model, tea.Cmd) {
+	m.input.Reset()
+	if s := m.bus.GetSession(m.session); s == nil || !s.Interrupted() {
+		m.addSystemMsg("Nothing to resume: the last turn finished.")
+		m.updateViewport()
+		return m, nil
+	}
+	if steps > 0 {
+		m.addSystemMsg(fmt.Sprintf("Continuing the turn for up to %d steps", steps))
+	} else {
+		m.addSystemMsg("Resuming the interrupted turn")
+	}
+	return m.run("", nil, nil, steps)
+}
+
 func (m *Model) handleCommand(text string) (tea.Cmd, bool) {
 	parts := strings.Fields(text)
 	if len(parts) == 0 || !strings.HasPrefix(parts[0], "/") {
 		return nil, false
 	}
 
+	var cmd tea.Cmd
 	switch parts[0] {
 	case "/new":
-		m.session = newSessionID()
+		m.session = msg.NewSessionID()
 		m.messages = nil
+		clear(m.diffCache)
 	case "/clear":
 		m.messages = nil
+		clear(m.diffCache)
 	case "/models":
 		m.cmdModels()
 	case "/model":
@@ -308,6 +569,16 @@ func (m *Model) handleCommand(text string) (tea.Cmd, bool) {
 		m.cmdSessions()
 	case "/switch":
 		m.cmdSwitch(parts)
+	case "/diff":
+		m.cmdDiff(parts)
+	case "/mode":
+		m.cmdMode(parts)
+	case "/queue":
+		m.cmdQueue(parts)
+	case "/usage":
+		m.cmdUsage(parts)
+	case "/commit":
+		cmd = m.cmdCommit(text)
 	case "/compact":
 		m.addSystemMsg("Auto-compact triggers at 60000 tokens. Session compacts automatically when needed.")
 	case "/help":
@@ -318,7 +589,7 @@ func (m *Model) handleCommand(text string) (tea.Cmd, bool) {
 
 	m.input.Reset()
 	m.updateViewport()
-	return nil, true
+	return cmd, true
 }
 
 func (m *Model) addSystemMsg(content string) {
@@ -368,8 +639,12 @@ func (m *Model) cmdModel(parts []string) {
 		return
 	}
 
-	m.agent = agent.New(newLLM, m.tools)
-	m.addSystemMsg(fmt.Sprintf("Switched to %s/%s", provider, config.C.CurrentModelName()))
+	m.agent = agent.NewWithMode(newLLM, m.tools, m.agent.Mode())
+	switched := fmt.Sprintf("Switched to %s/%s", provider, config.C.CurrentModelName())
+	if small := m.agent.SmallModel(); small != newLLM.Model() {
+		switched += fmt.Sprintf(" (small model: %s)", small)
+	}
+	m.addSystemMsg(switched)
 
 	if err := config.Save(); err != nil {
 		m.addErrorMsg(fmt.Sprintf("Failed to save config: %v", err))
@@ -425,26 +700,90 @@ func (m *Model) cmdSwitch(parts []string) {
 	}
 	m.session = parts[1]
 	m.messages = nil
+	clear(m.diffCache)
 	for _, msg := range session.Messages {
 		m.messages = append(m.messages, message{role: msg.Role, content: msg.Text})
 	}
+	if session.Interrupted() {
+		m.addSystemMsg("The last turn was interrupted. Use /resume to continue it.")
+	}
+}
+
+func (m *Model) cmdDiff(parts []string) {
+	if len(parts) < 2 || (parts[1] != "unified" && parts[1] != "split") {
+		m.addSystemMsg("Usage: /diff unified|split")
+		return
+	}
+	m.diffSplit = parts[1] == "split"
+	clear(m.diffCache)
+	m.addSystemMsg("Diff view: " + parts[1])
+}
+
+func (m *Model) cmdMode(parts []string) {
+	if len(parts) < 2 {
+		var sb strings.Builder
+		sb.WriteString("Modes:\n")
+		cur := m.agent.Mode().Name
+		for _, md := range mode.All() {
+			if md.Name == cur {
+				sb.WriteString("* ")
+			} else {
+				sb.WriteString("  ")
+			}
+			sb.WriteString(md.Name)
+			if md.Description != "" {
+				sb.WriteString(" - " + md.Description)
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("Usage: /mode <name>")
+		m.addSystemMsg(sb.String())
+		return
+	}
+	md, ok := mode.Find(parts[1])
+	if !ok {
+		m.addErrorMsg(fmt.Sprintf("Mode '%s' not found. Use /mode to list.", parts[1]))
+		return
+	}
+	m.setMode(md)
 }
 
 func (m *Model) cmdHelp() {
+	var custom strings.Builder
+	for _, c := range command.All() {
+		if slices.Contains(builtinCommands, "/"+c.Name) {
+			continue
+		}
+		if custom.Len() == 0 {
+			custom.WriteString("\nCustom commands:\n")
+		}
+		fmt.Fprintf(&custom, "  /%-8s %s\n", c.Name, c.Description)
+	}
+
 	m.addSystemMsg(`Commands:
   /new      Create new session
   /clear    Clear messages
   /sessions List all sessions
   /switch   Switch session
+  /resume   Continue an interrupted turn
+  /continue Continue a paused turn, optionally for N more steps
   /models   List available models
   /model    Switch model
+  /mode     List or switch agent modes
   /compact  Show compact info
+  /usage    Token usage by model, turn and step
+  /commit   Commit staged changes with a generated message
+  /diff     Diff view: unified or split
+  /init     Draft an AGENTS.md for this repo
+  /queue    List or clear messages queued while the agent runs
   /help     Show this help
-
+` + custom.String() + `
 Shortcuts:
-  Enter   Send message
-  Tab     Switch mode
+  Enter   Send message, or queue it while the agent is running
+  Up      Edit the last queued message (when the input is empty)
+  Tab     Switch mode, or complete a /command or @file
   Ctrl+J  New line
+  Ctrl+O  Expand/collapse diffs
   Ctrl+C  Quit`)
 }
 
@@ -453,11 +792,17 @@ func (m Model) handleEvent(ev event.Event) (tea.Model, tea.Cmd) {
 	case event.ToolStart:
 		if data, ok := ev.Data.(event.ToolStartData); ok {
 			m.toolName = data.Name
-			m.messages = append(m.messages, message{
-				role:    "tool:start:" + data.Name,
-				content: "",
-				args:    data.Args,
-			})
+			start := message{
+				role:   "tool:start:" + data.Name,
+				args:   data.Args,
+				id:     data.ID,
+				parent: ev.Parent,
+			}
+			if ev.Parent != "" {
+				m.insertChild(start)
+			} else {
+				m.messages = append(m.messages, start)
+			}
 			m.updateViewport()
 		}
 		return m, tea.Batch(m.spinner.Tick, waitForEvent(m.events))
@@ -472,14 +817,27 @@ func (m Model) handleEvent(ev event.Event) (tea.Model, tea.Cmd) {
 			if data.Error != "" {
 				result = data.Error
 			}
-			var args string
+			start := -1
 			for i := len(m.messages) - 1; i >= 0; i-- {
-				if m.messages[i].role == "tool:start:"+data.Name {
-					args = m.messages[i].args
+				if m.messages[i].role == "tool:start:"+data.Name && (data.ID == "" || m.messages[i].id == data.ID) {
+					start = i
 					break
 				}
 			}
-			m.messages = append(m.messages, message{role: role, content: result, args: args})
+			var args string
+			if start >= 0 {
+				args = m.messages[start].args
+			}
+			end := message{role: role, content: result, args: args, diffs: data.Diffs, id: data.ID, parent: ev.Parent}
+			if ev.Parent != "" && start >= 0 {
+				// Sub-agent calls collapse into one line under their task
+				if data.Error == "" {
+					end.content = ""
+				}
+				m.messages[start] = end
+			} else {
+				m.messages = append(m.messages, end)
+			}
 			m.updateViewport()
 		}
 		return m, tea.Batch(m.spinner.Tick, waitForEvent(m.events))
@@ -504,6 +862,13 @@ func (m Model) handleEvent(ev event.Event) (tea.Model, tea.Cmd) {
 		}
 		return m, tea.Batch(m.spinner.Tick, waitForEvent(m.events))
 
+	case event.UserMessage:
+		if data, ok := ev.Data.(event.UserMessageData); ok {
+			m.messages = append(m.messages, message{role: "user", content: data.Text})
+			m.updateViewport()
+		}
+		return m, waitForEvent(m.events)
+
 	case event.TextDelta:
 		if data, ok := ev.Data.(event.TextDeltaData); ok {
 			if len(m.messages) > 0 && m.messages[len(m.messages)-1].role == "assistant" {
@@ -515,10 +880,24 @@ func (m Model) handleEvent(ev event.Event) (tea.Model, tea.Cmd) {
 		}
 		return m, waitForEvent(m.events)
 
+	case event.Usage:
+		if data, ok := ev.Data.(event.UsageData); ok {
+			m.addUsage(data.Usage)
+		}
+		return m, waitForEvent(m.events)
+
 	case event.Done:
-		if data, ok := ev.Data.(event.DoneData); ok {
-			m.inputTokens += data.InputTokens
-			m.outputTokens += data.OutputTokens
+		m.thinking = false
+		m.toolName = ""
+		m.updateViewport()
+		return m, waitForEvent(m.events)
+
+	case event.Paused:
+		if data, ok := ev.Data.(event.PausedData); ok {
+			m.addSystemMsg(fmt.Sprintf("Paused: %s. Use /continue to keep going, or /continue N for N more steps.", data.Reason))
+		}
+		if m.thinking {
+			m.unqueue()
 		}
 		m.thinking = false
 		m.toolName = ""
@@ -529,13 +908,17 @@ func (m Model) handleEvent(ev event.Event) (tea.Model, tea.Cmd) {
 		if data, ok := ev.Data.(event.ErrorData); ok {
 			m.messages = append(m.messages, message{role: "error", content: data.Message})
 		}
+		if m.thinking {
+			m.unqueue()
+		}
 		m.thinking = false
 		m.toolName = ""
 		m.updateViewport()
-		return m, nil
+		return m, waitForEvent(m.events)
 	}
 
-	return m, nil
+	// Events the TUI doesn't show, such as steps being saved
+	return m, waitForEvent(m.events)
 }
 
 func (m *Model) initMarkdownRenderer() {
@@ -560,10 +943,36 @@ func (m *Model) renderMarkdown(content string) string {
 	return strings.TrimRight(out, "\n")
 }
 
+// insertChild places a sub-agent message after the task call it belongs to
+// and that task's earlier sub-agent messages
+func (m *Model) insertChild(child message) {
+	at := -1
+	for i, msg := range m.messages {
+		if msg.id == child.parent || msg.parent == child.parent {
+			at = i + 1
+		}
+	}
+	if at < 0 {
+		m.messages = append(m.messages, child)
+		return
+	}
+	m.messages = slices.Insert(m.messages, at, child)
+}
+
 func (m *Model) updateViewport() {
 	var sb strings.Builder
 	for i, msg := range m.messages {
-		m.renderMsg(&sb, msg)
+		if msg.parent != "" {
+			var child strings.Builder
+			m.renderMsg(&child, msg)
+			for _, line := range strings.SplitAfter(child.String(), "\n") {
+				if line != "" {
+					sb.WriteString("    " + line)
+				}
+			}
+		} else {
+			m.renderMsg(&sb, msg)
+		}
 		if i < len(m.messages)-1 && m.needsGap(msg.role, m.messages[i+1].role) {
 			sb.WriteString("\n")
 		}
@@ -598,6 +1007,7 @@ func (m *Model) renderMsg(sb *strings.Builder, msg message) {
 			PaddingLeft(1).
 			Render(msg.content))
 		sb.WriteString("\n")
+		renderAttachments(sb, msg.attachments, msg.images)
 	case msg.role == "assistant":
 		sb.WriteString(lipgloss.NewStyle().Foreground(fgMuted).Render("Assistant"))
 		sb.WriteString("\n")
@@ -613,7 +1023,7 @@ func (m *Model) renderMsg(sb *strings.Builder, msg message) {
 	case strings.HasPrefix(msg.role, "tool:start:"):
 		m.renderToolStart(sb, strings.TrimPrefix(msg.role, "tool:start:"), msg.args)
 	case strings.HasPrefix(msg.role, "tool:end:"):
-		m.renderToolEnd(sb, strings.TrimPrefix(msg.role, "tool:end:"), msg.content, msg.args)
+		m.renderToolEnd(sb, strings.TrimPrefix(msg.role, "tool:end:"), msg.id, msg.content, msg.args, msg.diffs)
 	case strings.HasPrefix(msg.role, "tool:error:"):
 		m.renderToolError(sb, strings.TrimPrefix(msg.role, "tool:error:"), msg.content, msg.args)
 	case msg.role == "compact:start":
@@ -649,10 +1059,15 @@ func (m *Model) renderToolStart(sb *strings.Builder, name, args string) {
 	sb.WriteString("\n")
 }
 
-func (m *Model) renderToolEnd(sb *strings.Builder, name, content, args string) {
+func (m *Model) renderToolEnd(sb *strings.Builder, name, id, content, args string, diffs []diff.File) {
 	icon := lipgloss.NewStyle().Foreground(success).Bold(true).SetString("✓")
 	label := lipgloss.NewStyle().Foreground(secondary).Render(name)
 	sb.WriteString("  " + icon.String() + " Used " + label + m.formatToolArgs(args))
+	if len(diffs) > 0 {
+		sb.WriteString("\n")
+		m.renderDiffs(sb, id, diffs)
+		return
+	}
 	if content == "" {
 		sb.WriteString("\n")
 		return
@@ -724,6 +1139,8 @@ func (m Model) View() string {
 			status += lipgloss.NewStyle().Foreground(fgMuted).Render("Thinking...")
 		}
 		statusLine = lipgloss.NewStyle().Foreground(fgMuted).Padding(0, 1).Render(status)
+	} else {
+		statusLine = m.attachmentLine()
 	}
 
 	if !m.viewport.AtBottom() {
@@ -749,7 +1166,7 @@ func (m Model) View() string {
 	modelInfo := lipgloss.NewStyle().Foreground(secondary).Render(config.C.CurrentProviderName() + "/" + config.C.CurrentModelName())
 	tokenInput := lipgloss.NewStyle().Foreground(fgMuted).Render(fmt.Sprintf("input:%d", m.inputTokens))
 	tokenOutput := lipgloss.NewStyle().Foreground(fgMuted).Render(fmt.Sprintf("output:%d", m.outputTokens))
-	modeInfo := lipgloss.NewStyle().Foreground(secondary).Render(m.agent.Mode())
+	modeInfo := lipgloss.NewStyle().Foreground(secondary).Render(m.agent.Mode().Name)
 	shortcuts := modelInfo +
 		lipgloss.NewStyle().Foreground(fgMuted).Render(" | ") +
 		modeInfo +
@@ -777,21 +1194,9 @@ func (m Model) View() string {
 	if statusLine != "" {
 		parts = append(parts, statusLine)
 	}
+	parts = append(parts, m.queueLines()...)
 	parts = append(parts, inputBox)
 	parts = append(parts, shortcuts)
 
 	return strings.Join(parts, "\n")
 }
-
-func msgsToLLM(msgs []msg.Msg) []llm.Message {
-	out := make([]llm.Message, len(msgs))
-	for i, m := range msgs {
-		out[i] = llm.Message{
-			Role:        m.Role,
-			Content:     m.Text,
-			ToolCalls:   m.ToolCalls,
-			ToolResults: m.ToolResults,
-		}
-	}
-	return out
-}
@@ -0,0 +1,153 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abcdlsj/otter/internal/msg"
+	"github.com/abcdlsj/otter/internal/types"
+)
+
+const maxUsageTurns = 10
+
+func (m *Model) addUsage(u types.Usage) {
+	m.inputTokens += u.Input
+	m.outputTokens += u.Output
+}
+
+// usageStep is one model call of a turn and the tools it asked for
+type usageStep struct {
+	usage types.Usage
+	tools []string
+}
+
+type usageTurn struct {
+	n     int
+	text  string
+	steps []usageStep
+	other []types.Usage // compaction and sub-agents
+	tools int
+}
+
+func (t usageTurn) all() []types.Usage {
+	us := slices.Clone(t.other)
+	for _, s := range t.steps {
+		us = append(us, s.usage)
+	}
+	return us
+}
+
+// usageTurns splits the saved messages into turns, each starting at a user message
+func usageTurns(msgs []msg.Msg) []usageTurn {
+	var turns []usageTurn
+	for _, mm := range msgs {
+		if mm.Role == "user" || len(turns) == 0 {
+			turns = append(turns, usageTurn{n: len(turns) + 1, text: mm.Text})
+		}
+		t := &turns[len(turns)-1]
+		switch {
+		case mm.Role == "assistant" && len(mm.Usage) > 0:
+			var tools []string
+			for _, tc := range mm.ToolCalls {
+				tools = append(tools, tc.Name)
+			}
+			t.steps = append(t.steps, usageStep{usage: mm.Usage[0], tools: tools})
+			t.tools += len(tools)
+			t.other = append(t.other, mm.Usage[1:]...)
+		default:
+			t.other = append(t.other, mm.Usage...)
+		}
+	}
+	return turns
+}
+
+// cmdUsage reports the session's token usage by model, by turn with the
+// heaviest first, and by step for the last turn or the one given
+func (m *Model) cmdUsage(parts []string) {
+	s := m.bus.GetSession(m.session)
+	if s == nil || len(s.Messages) == 0 {
+		m.addSystemMsg("No usage yet in this session.")
+		return
+	}
+	turns := usageTurns(s.Messages)
+
+	var all []types.Usage
+	for _, t := range turns {
+		all = append(all, t.all()...)
+	}
+	in, out := types.SumUsage(all)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Session usage: %s in / %s out, %d calls\n", formatTokens(in), formatTokens(out), len(all))
+	// Titles, summaries, condensing and commits go to the small model
+	aux := slices.DeleteFunc(slices.Clone(all), func(u types.Usage) bool { return u.Kind == "chat" || u.Kind == "task" })
+	if len(aux) > 0 {
+		in, out := types.SumUsage(aux)
+		fmt.Fprintf(&sb, "Auxiliary calls (%s): %s in / %s out, %d calls\n", m.agent.SmallModel(), formatTokens(in), formatTokens(out), len(aux))
+	}
+
+	sb.WriteString("\nBy model:\n")
+	byModel := make(map[string][]types.Usage)
+	var models []string
+	for _, u := range all {
+		key := u.Model
+		if u.Kind != "chat" {
+			key += " (" + u.Kind + ")"
+		}
+		if _, ok := byModel[key]; !ok {
+			models = append(models, key)
+		}
+		byModel[key] = append(byModel[key], u)
+	}
+	slices.Sort(models)
+	for _, key := range models {
+		in, out := types.SumUsage(byModel[key])
+		fmt.Fprintf(&sb, "  %-36s %8s in %8s out %4d calls\n", key, formatTokens(in), formatTokens(out), len(byModel[key]))
+	}
+
+	sb.WriteString("\nTurns by tokens:\n")
+	sorted := slices.Clone(turns)
+	slices.SortStableFunc(sorted, func(a, b usageTurn) int {
+		ai, ao := types.SumUsage(a.all())
+		bi, bo := types.SumUsage(b.all())
+		return cmp.Compare(bi+bo, ai+ao)
+	})
+	for _, t := range sorted[:min(len(sorted), maxUsageTurns)] {
+		in, out := types.SumUsage(t.all())
+		text := types.TruncateRunes(strings.Join(strings.Fields(t.text), " "), 40)
+		fmt.Fprintf(&sb, "  #%-3d %8s in %8s out %3d steps %3d tools  %q\n", t.n, formatTokens(in), formatTokens(out), len(t.steps), t.tools, text)
+	}
+
+	pick := turns[len(turns)-1]
+	if len(parts) > 1 {
+		n, err := strconv.Atoi(strings.TrimPrefix(parts[1], "#"))
+		if err != nil || n < 1 || n > len(turns) {
+			m.addErrorMsg(fmt.Sprintf("Usage: /usage [turn], turn is 1-%d", len(turns)))
+			return
+		}
+		pick = turns[n-1]
+	}
+	fmt.Fprintf(&sb, "\nSteps of turn #%d (/usage N for another):\n", pick.n)
+	for i, st := range pick.steps {
+		fmt.Fprintf(&sb, "  %-3d %8s in %8s out  %s\n", i+1, formatTokens(st.usage.Input), formatTokens(st.usage.Output), strings.Join(st.tools, ", "))
+	}
+	for _, u := range pick.other {
+		fmt.Fprintf(&sb, "  +   %8s in %8s out  %s (%s)\n", formatTokens(u.Input), formatTokens(u.Output), u.Kind, u.Model)
+	}
+	m.addSystemMsg(strings.TrimRight(sb.String(), "\n"))
+}
+
+func formatTokens(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 10_000:
+		return fmt.Sprintf("%.0fk", float64(n)/1000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return strconv.FormatInt(n, 10)
+}
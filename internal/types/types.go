@@ -1,5 +1,11 @@
 package types
 
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 type ToolCall struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
@@ -7,8 +13,55 @@ type ToolCall struct {
 }
 
 type ToolResult struct {
-	ToolCallID string `json:"tool_call_id"`
-	Content    string `json:"content"`
+	ToolCallID string  `json:"tool_call_id"`
+	Content    string  `json:"content"`
+	Images     []Image `json:"images,omitempty"`
+}
+
+// Image is an image sent to the model. Only its path is persisted; the
+// data is read back from there when it isn't loaded.
+type Image struct {
+	Path      string `json:"path"`
+	MediaType string `json:"media_type"` // image/png, image/jpeg, image/gif or image/webp
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Data      []byte `json:"-"`
+}
+
+// Bytes returns the image data, reading it from Path if needed
+func (i Image) Bytes() ([]byte, error) {
+	if i.Data != nil {
+		return i.Data, nil
+	}
+	return os.ReadFile(i.Path)
+}
+
+// Attachment is context the user attached to a message with an @mention
+type Attachment struct {
+	Kind    string `json:"kind"` // file, dir or url
+	Ref     string `json:"ref"`  // the mention as typed, without "@"
+	Path    string `json:"path,omitempty"`
+	Start   int    `json:"start,omitempty"` // 1-based line range, 0 for the whole file
+	End     int    `json:"end,omitempty"`
+	Content string `json:"content"`
+	Tokens  int64  `json:"tokens,omitempty"`
+}
+
+// Usage is the token usage of one model call
+type Usage struct {
+	Kind   string `json:"kind"` // chat, compact, title, task, commit or the tool whose output was condensed
+	Model  string `json:"model"`
+	Input  int64  `json:"input_tokens"`
+	Output int64  `json:"output_tokens"`
+}
+
+// SumUsage adds up the input and output tokens of us
+func SumUsage(us []Usage) (input, output int64) {
+	for _, u := range us {
+		input += u.Input
+		output += u.Output
+	}
+	return input, output
 }
 
 func TruncateRunes(s string, n int) string {
@@ -18,3 +71,16 @@ func TruncateRunes(s string, n int) string {
 	}
 	return string(r[:n])
 }
+
+// DisplayPath shows path relative to the working directory when it is
+// inside it, and unchanged otherwise
+func DisplayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,65 @@
+// Package workspace lists the files of the project otter works in
+package workspace
+
+import (
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SkipDir reports whether a directory holds dependencies, build output or
+// caches, which are never worth walking. Hidden directories are skipped too.
+func SkipDir(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	switch name {
+	case "node_modules", "vendor", "dist", "build", "target", "__pycache__":
+		return true
+	}
+	return false
+}
+
+// Files returns up to limit files under root for which keep reports true,
+// relative to root. In a git repo .gitignore is honoured; elsewhere the tree
+// is walked, leaving out SkipDir directories.
+func Files(root string, limit int, keep func(rel string) bool) []string {
+	var files []string
+	cmd := exec.Command("git", "ls-files", "-co", "--exclude-standard")
+	cmd.Dir = root
+	if out, err := cmd.Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if line == "" {
+				continue
+			}
+			if rel := filepath.FromSlash(line); keep(rel) {
+				files = append(files, rel)
+			}
+			if len(files) >= limit {
+				break
+			}
+		}
+		return files
+	}
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && SkipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(files) >= limit {
+			return filepath.SkipAll
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && keep(rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files
+}
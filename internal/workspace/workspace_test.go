@@ -0,0 +1,31 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFilesWalkSkipsDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{"main.go", "pkg/a.go", "pkg/a.txt", "node_modules/x/x.go", ".git/config", "vendor/v.go"} {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := Files(root, 10, func(rel string) bool { return strings.HasSuffix(rel, ".go") })
+	want := []string{"main.go", filepath.Join("pkg", "a.go")}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Files = %v, want %v", got, want)
+	}
+	if got := Files(root, 1, func(string) bool { return true }); len(got) != 1 {
+		t.Fatalf("limit 1 returned %v", got)
+	}
+}
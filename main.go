@@ -2,15 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/abcdlsj/otter/internal/acp"
 	"github.com/abcdlsj/otter/internal/agent"
 	"github.com/abcdlsj/otter/internal/config"
 	"github.com/abcdlsj/otter/internal/llm"
+	"github.com/abcdlsj/otter/internal/lsp"
 	"github.com/abcdlsj/otter/internal/msg"
+	"github.com/abcdlsj/otter/internal/server"
 	"github.com/abcdlsj/otter/internal/tool"
 	"github.com/abcdlsj/otter/internal/tui"
 )
@@ -28,9 +38,30 @@ func main() {
 	}
 
 	tools := tool.NewSet()
-	ag := agent.New(llmClient, tools)
 	bus := msg.NewBus(config.SessionsDir())
 
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		err := serve(llmClient, tools, bus, os.Args[2:])
+		lsp.Shared().Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "acp" {
+		err := acp.New(llmClient, tools, bus).Serve(context.Background(), os.Stdin, os.Stdout)
+		lsp.Shared().Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ACP error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ag := agent.New(llmClient, tools)
+
 	model := tui.New(ag, tools, bus)
 	program := tea.NewProgram(
 		model,
@@ -39,8 +70,42 @@ func main() {
 		tea.WithContext(context.Background()),
 	)
 
-	if _, err := program.Run(); err != nil {
+	_, err = program.Run()
+	lsp.Shared().Close()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// serve runs the HTTP API for editors and other clients until interrupted
+func serve(l *llm.LLM, tools *tool.Set, bus *msg.Bus, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:7420", "address to listen on")
+	fs.Parse(args)
+
+	token, err := server.Token()
+	if err != nil {
+		return fmt.Errorf("load token: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: server.New(l, tools, bus, token).Handler(),
+		// Ends event streams on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("Otter serving on http://%s (token in %s)\n", *addr, server.TokenPath())
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}